@@ -25,52 +25,28 @@ func (t *getHostnameAndIP) Metadata() *gornir.TaskMetadata {
 	return nil
 }
 
-// This is going to be your task result, you can have whatever you want here
-type getHostnameAndIPResult struct {
-	SubResults []gornir.TaskInstanceResult // Result of running various commands
-}
-
-// String implements fmt.Stringer interface. This basically allows us to control the output when printing the object
-func (r getHostnameAndIPResult) String() string {
-	res := ""
-	for _, r := range r.SubResults {
-		res += fmt.Sprintf("%s\n", r)
-	}
-	return res
-}
-
-// Here is where you implement your logic
+// Here is where you implement your logic. Subtasks executed with gornir.RunSubtask
+// are recorded in the JobResult of this task so we don't need to keep track of them
 func (t *getHostnameAndIP) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
-	resOpen, err := (&connection.SSHOpen{}).Run(ctx, logger, host)
-	if err != nil {
-		return getHostnameAndIPResult{}, err
+	if _, err := gornir.RunSubtask(ctx, logger, host, &connection.SSHOpen{}); err != nil {
+		return nil, err
 	}
 
-	// We call the first subtask and store the subresult
-	res1, err := (&task.RemoteCommand{Command: "hostname"}).Run(ctx, logger, host)
-	if err != nil {
-		return getHostnameAndIPResult{}, err
+	// We call the first subtask
+	if _, err := gornir.RunSubtask(ctx, logger, host, &task.RemoteCommand{Command: "hostname"}); err != nil {
+		return nil, err
 	}
 
-	// We call the second subtask and store the subresult
-	res2, err := (&task.RemoteCommand{Command: "ip addr | grep \\/24 | awk '{ print $2 }'"}).Run(ctx, logger, host)
-	if err != nil {
-		return getHostnameAndIPResult{}, err
+	// We call the second subtask
+	if _, err := gornir.RunSubtask(ctx, logger, host, &task.RemoteCommand{Command: "ip addr | grep \\/24 | awk '{ print $2 }'"}); err != nil {
+		return nil, err
 	}
 
-	resClose, err := (&connection.SSHClose{}).Run(ctx, logger, host)
-	if err != nil {
-		return getHostnameAndIPResult{}, err
+	if _, err := gornir.RunSubtask(ctx, logger, host, &connection.SSHClose{}); err != nil {
+		return nil, err
 	}
 
-	return getHostnameAndIPResult{
-		SubResults: []gornir.TaskInstanceResult{
-			resOpen,
-			res1,
-			res2,
-			resClose,
-		},
-	}, nil
+	return nil, nil
 }
 
 func main() {
@@ -122,7 +98,12 @@ func main() {
 			if res.Err() != nil {
 				fmt.Printf("ERROR: %s: %s\n", res.Host().Hostname, res.Err().Error())
 			} else {
-				fmt.Printf("OK: %s:\n%s\n", res.Host().Hostname, res.Data().(gornir.TaskInstanceResult))
+				fmt.Printf("OK: %s:\n", res.Host().Hostname)
+				// each subtask left its result in the JobResult
+				for _, sub := range res.SubResults() {
+					fmt.Printf("%s\n", sub.Data())
+				}
+				fmt.Println()
 			}
 		case <-time.After(time.Second * 10):
 			return
@@ -0,0 +1,85 @@
+// this example does the same as 6_custom_ssh_config using the authentication
+// methods built into connection.SSHOpen instead of a custom ssh.ClientConfig
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/connection"
+	"github.com/nornir-automation/gornir/pkg/plugins/inventory"
+	"github.com/nornir-automation/gornir/pkg/plugins/logger"
+	"github.com/nornir-automation/gornir/pkg/plugins/output"
+	"github.com/nornir-automation/gornir/pkg/plugins/runner"
+	"github.com/nornir-automation/gornir/pkg/plugins/task"
+)
+
+func main() {
+	// Instantiate a logger plugin
+	log := logger.NewLogrus(false)
+
+	// Load the inventory using the FromYAMLFile plugin
+	file := "/go/src/github.com/nornir-automation/gornir/examples/hosts.yaml"
+	plugin := inventory.FromYAML{HostsFile: file}
+	inv, err := plugin.Create()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rnr := runner.Sorted()
+
+	gr := gornir.New().WithInventory(inv).WithLogger(log).WithRunner(rnr)
+
+	// Open an SSH connection towards the devices authenticating with a private key
+	// and falling back to the password if the key is not accepted. The key is the
+	// one used in 6_custom_ssh_config
+	results, err := gr.RunSync(
+		context.Background(),
+		&connection.SSHOpen{
+			Auth: &connection.Auth{
+				Methods:         []string{connection.AuthPublicKey, connection.AuthPassword},
+				PrivateKeyFiles: []string{"/go/src/github.com/nornir-automation/gornir/examples/6_custom_ssh_config/id_rsa"},
+			},
+		},
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	output.RenderResults(os.Stdout, results, "Connecting to devices via ssh", true)
+
+	// defer closing the SSH connection we just opened
+	defer func() {
+		results, err = gr.RunSync(
+			context.Background(),
+			&connection.SSHClose{},
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		output.RenderResults(os.Stdout, results, "Close ssh connection", true)
+	}()
+
+	// Following call is going to execute the task over all the hosts using the runner.Parallel runner.
+	// Said runner is going to handle the parallelization for us. Gornir.RunS is also going to block
+	// until the runner has completed executing the task over all the hosts
+	results, err = gr.RunSync(
+		context.Background(),
+		&task.RemoteCommand{Command: "ip addr | grep \\/24 | awk '{ print $2 }'"},
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// next call is going to print the result on screen
+	output.RenderResults(os.Stdout, results, "What is my ip?", true)
+
+	// Now we upload a file. This shows how the ssh connection is shared across tasks of same or different type
+	results, err = gr.RunSync(
+		context.Background(),
+		&task.SFTPUpload{Src: "/etc/hosts", Dst: "/tmp/asd"},
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	output.RenderResults(os.Stdout, results, "Upload File", true)
+}
@@ -0,0 +1,137 @@
+package gornir
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AggregatedResult groups the JobResults of running a task over the inventory.
+// Results are keyed by the name the host they belong to has in the inventory, see Host.Name
+type AggregatedResult map[string]*JobResult
+
+// Aggregate reads all the JobResults from the channel and returns them as an
+// AggregatedResult. The channel needs to be closed for Aggregate to return, which is
+// already the case for the channel returned by Gornir.RunSync. If you are using
+// Gornir.RunAsync make sure you close the channel once the Runner is done.
+func Aggregate(results chan *JobResult) AggregatedResult {
+	agg := make(AggregatedResult)
+	for res := range results {
+		agg[resultKey(res.Host())] = res
+	}
+	return agg
+}
+
+// resultKey returns the name of the host in the inventory, falling back to its
+// hostname for hosts that are not part of one
+func resultKey(host *Host) string {
+	if host.Name != "" {
+		return host.Name
+	}
+	return host.Hostname
+}
+
+// ResultSummary contains the number of TaskInstances per outcome
+type ResultSummary struct {
+	Total     int // Total number of TaskInstances
+	Succeeded int // Number of TaskInstances that completed without errors
+	Failed    int // Number of TaskInstances that returned an error
+	Skipped   int // Number of TaskInstances that were not executed, see JobResult.Skipped
+}
+
+// String implements the Stringer interface
+func (s ResultSummary) String() string {
+	return fmt.Sprintf("total: %d, succeeded: %d, failed: %d, skipped: %d", s.Total, s.Succeeded, s.Failed, s.Skipped)
+}
+
+// Get returns the JobResult of the host with the given name or nil if there is none
+func (a AggregatedResult) Get(name string) *JobResult {
+	return a[name]
+}
+
+// Hostnames returns the names of the hosts in the AggregatedResult sorted alphabetically
+func (a AggregatedResult) Hostnames() []string {
+	hostnames := make([]string, 0, len(a))
+	for hostname := range a {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+	return hostnames
+}
+
+// Failed returns a new AggregatedResult with only the JobResults that contain an error
+func (a AggregatedResult) Failed() AggregatedResult {
+	failed := make(AggregatedResult)
+	for hostname, res := range a {
+		if res.Err() != nil {
+			failed[hostname] = res
+		}
+	}
+	return failed
+}
+
+// Succeeded returns a new AggregatedResult with only the JobResults without errors
+func (a AggregatedResult) Succeeded() AggregatedResult {
+	succeeded := make(AggregatedResult)
+	for hostname, res := range a {
+		if res.Err() == nil {
+			succeeded[hostname] = res
+		}
+	}
+	return succeeded
+}
+
+// Errors returns the errors of the failed JobResults keyed by the name of the host
+func (a AggregatedResult) Errors() map[string]error {
+	errs := make(map[string]error)
+	for hostname, res := range a {
+		if res.Err() != nil {
+			errs[hostname] = res.Err()
+		}
+	}
+	return errs
+}
+
+// Summary returns the number of TaskInstances per outcome
+func (a AggregatedResult) Summary() ResultSummary {
+	s := ResultSummary{Total: len(a)}
+	for _, res := range a {
+		switch {
+		case res.Skipped():
+			s.Skipped++
+		case res.Err() == nil:
+			s.Succeeded++
+		default:
+			s.Failed++
+		}
+	}
+	return s
+}
+
+// RaiseOnError returns an AggregatedError if any of the JobResults contains an error
+func (a AggregatedResult) RaiseOnError() error {
+	errs := a.Errors()
+	if len(errs) == 0 {
+		return nil
+	}
+	return AggregatedError(errs)
+}
+
+// AggregatedError is the error returned by AggregatedResult.RaiseOnError.
+// It contains the errors of the failed hosts keyed by their name
+type AggregatedError map[string]error
+
+// Error implements the error interface
+func (e AggregatedError) Error() string {
+	hostnames := make([]string, 0, len(e))
+	for hostname := range e {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	errs := make([]string, len(hostnames))
+	for i, hostname := range hostnames {
+		errs[i] = fmt.Sprintf("%s: %s", hostname, e[hostname])
+	}
+	return fmt.Sprintf("%d host(s) failed: %s", len(e), strings.Join(errs, "; "))
+}
@@ -0,0 +1,141 @@
+package gornir_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/logger"
+	"github.com/nornir-automation/gornir/pkg/plugins/runner"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAggregatedResult(t *testing.T) {
+	inv := gornir.Inventory{
+		Hosts: map[string]*gornir.Host{
+			"host1": {Hostname: "host1"},
+			"host2": {Hostname: "host2"},
+			"host3": {Hostname: "host3"},
+			"host4": {Hostname: "host4"},
+			"host5": {Hostname: "host5"},
+		},
+	}
+	gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Sorted())
+
+	testCases := []struct {
+		name string
+		run  func() gornir.AggregatedResult
+	}{
+		{
+			name: "sync",
+			run: func() gornir.AggregatedResult {
+				results, err := gr.WithFailurePolicy(gornir.FailurePolicy{MaxFailures: 3}).RunSync(context.Background(), &failingTask{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return gornir.Aggregate(results)
+			},
+		},
+		{
+			name: "async",
+			run: func() gornir.AggregatedResult {
+				results := make(chan *gornir.JobResult, len(inv.Hosts))
+				err := gr.WithFailurePolicy(gornir.FailurePolicy{MaxFailures: 3}).RunAsync(context.Background(), &failingTask{}, results)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := gr.Runner.Wait(); err != nil {
+					t.Fatal(err)
+				}
+				close(results)
+				return gornir.Aggregate(results)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			agg := tc.run()
+
+			if !cmp.Equal(agg.Hostnames(), []string{"host1", "host2", "host3", "host4", "host5"}) {
+				t.Errorf("unexpected hostnames: %v", agg.Hostnames())
+			}
+			if !cmp.Equal(agg.Failed().Hostnames(), []string{"host1", "host2", "host4", "host5"}) {
+				t.Errorf("unexpected failed hosts: %v", agg.Failed().Hostnames())
+			}
+			if !cmp.Equal(agg.Succeeded().Hostnames(), []string{"host3"}) {
+				t.Errorf("unexpected succeeded hosts: %v", agg.Succeeded().Hostnames())
+			}
+			if agg.Get("host1").Err() != errFail || agg.Get("nope") != nil {
+				t.Error("Get didn't return the expected results")
+			}
+
+			expectedSummary := gornir.ResultSummary{Total: 5, Succeeded: 1, Failed: 3, Skipped: 1}
+			if agg.Summary() != expectedSummary {
+				t.Errorf("got summary %v, want %v", agg.Summary(), expectedSummary)
+			}
+
+			expectedErrors := map[string]error{"host1": errFail, "host2": errFail, "host4": errFail, "host5": gornir.ErrSkipped}
+			if !cmp.Equal(agg.Errors(), expectedErrors, cmp.Comparer(func(x, y error) bool { return x == y })) {
+				t.Errorf("got errors %v, want %v", agg.Errors(), expectedErrors)
+			}
+
+			err := agg.RaiseOnError()
+			expectedErr := "4 host(s) failed: host1: failed; host2: failed; host4: failed; host5: skipped: failure budget exhausted"
+			if err == nil || err.Error() != expectedErr {
+				t.Errorf("got error '%v', want '%s'", err, expectedErr)
+			}
+			if err := agg.Succeeded().RaiseOnError(); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestAggregatedResultNames(t *testing.T) {
+	// results are keyed by the name of the hosts, which doesn't need to match their hostname
+	inv := gornir.Inventory{
+		Hosts: map[string]*gornir.Host{
+			"dev1": {Hostname: "shared"},
+			"dev2": {Hostname: "shared"},
+			"dev3": {},
+		},
+	}
+	gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Sorted())
+	results, err := gr.RunSync(context.Background(), &failingTask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg := gornir.Aggregate(results)
+	if !cmp.Equal(agg.Hostnames(), []string{"dev1", "dev2", "dev3"}) {
+		t.Errorf("unexpected hostnames: %v", agg.Hostnames())
+	}
+	if agg.Get("dev2").Host() != inv.Hosts["dev2"] {
+		t.Error("Get didn't return the result of the host")
+	}
+}
+
+func TestAggregatedResultCancelled(t *testing.T) {
+	// hosts that didn't start before the context was done are skipped
+	inv := gornir.Inventory{
+		Hosts: map[string]*gornir.Host{
+			"host1": {Hostname: "host1"},
+			"host2": {Hostname: "host2"},
+		},
+	}
+	gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Sorted())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := gr.RunSync(ctx, &failingTask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg := gornir.Aggregate(results)
+	if expected := (gornir.ResultSummary{Total: 2, Skipped: 2}); agg.Summary() != expected {
+		t.Errorf("got summary %v, want %v", agg.Summary(), expected)
+	}
+	if err := agg.Get("host1").Err(); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
@@ -2,9 +2,57 @@ package gornir
 
 import (
 	"context"
+	"sync"
 )
 
 // Connection defines an interface to write connection tasks
 type Connection interface {
 	Close(context.Context) error // Close closes the connection
 }
+
+// HealthChecker is an optional interface a Connection can implement to report if it's
+// still usable. Connections implementing it are checked by Host.GetConnectionContext
+// before handing them out so dead ones are replaced by new ones
+type HealthChecker interface {
+	IsAlive(context.Context) bool // IsAlive returns false if the connection can't be used anymore
+}
+
+// isAlive returns if the connection is still usable, connections that
+// don't implement HealthChecker are assumed to be
+func isAlive(ctx context.Context, conn Connection) bool {
+	hc, ok := conn.(HealthChecker)
+	return !ok || hc.IsAlive(ctx)
+}
+
+// Reopener is an optional interface a Connection can implement to open a new connection
+// with the same settings it was opened with. Dead connections implementing it are
+// replaced by Host.GetConnectionContext with the one returned by Reopen instead of
+// with a connection opened by the ConnectionFactory registered under its name
+type Reopener interface {
+	Reopen(context.Context, *Host) (Connection, error) // Reopen opens a new connection towards the host
+}
+
+// ConnectionFactory opens a new connection towards the host
+type ConnectionFactory func(context.Context, *Host) (Connection, error)
+
+var (
+	connectionFactories    = make(map[string]ConnectionFactory)
+	connectionFactoriesMux = &sync.RWMutex{}
+)
+
+// RegisterConnection registers a ConnectionFactory under the given name. Once registered,
+// Host.GetConnection will use it to open connections with that name on first use.
+// Registering a factory with a name that already exists replaces the existing one
+func RegisterConnection(name string, factory ConnectionFactory) {
+	connectionFactoriesMux.Lock()
+	defer connectionFactoriesMux.Unlock()
+	connectionFactories[name] = factory
+}
+
+// getConnectionFactory returns the ConnectionFactory registered under the given name
+func getConnectionFactory(name string) (ConnectionFactory, bool) {
+	connectionFactoriesMux.RLock()
+	defer connectionFactoriesMux.RUnlock()
+	f, ok := connectionFactories[name]
+	return f, ok
+}
@@ -0,0 +1,208 @@
+package gornir_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/logger"
+	"github.com/nornir-automation/gornir/pkg/plugins/runner"
+)
+
+type countingFactory struct {
+	opened int32
+	conns  []*fakeConnection
+	mux    sync.Mutex
+}
+
+func (f *countingFactory) open(ctx context.Context, host *gornir.Host) (gornir.Connection, error) {
+	atomic.AddInt32(&f.opened, 1)
+	if host.Hostname == "broken" {
+		return nil, errors.New("can't connect")
+	}
+	conn := &fakeConnection{}
+	f.mux.Lock()
+	f.conns = append(f.conns, conn)
+	f.mux.Unlock()
+	return conn, nil
+}
+
+// connectionTask retrieves the connection "counting"
+type connectionTask struct {
+}
+
+func (t *connectionTask) Metadata() *gornir.TaskMetadata {
+	return nil
+}
+
+func (t *connectionTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	return host.GetConnectionContext(ctx, "counting")
+}
+
+func TestLazyConnection(t *testing.T) {
+	factory := &countingFactory{}
+	gornir.RegisterConnection("counting", factory.open)
+
+	host := &gornir.Host{Hostname: "host1"}
+
+	// we request the connection concurrently, it should only be opened once
+	wg := &sync.WaitGroup{}
+	conns := make([]gornir.Connection, 10)
+	for i := 0; i < len(conns); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := host.GetConnection("counting")
+			if err != nil {
+				t.Error(err)
+			}
+			conns[i] = conn
+		}(i)
+	}
+	wg.Wait()
+	if factory.opened != 1 {
+		t.Errorf("connection was opened %d times", factory.opened)
+	}
+	for _, conn := range conns {
+		if conn != conns[0] {
+			t.Error("got different connections")
+		}
+	}
+
+	if _, err := host.GetConnection("unregistered"); err == nil {
+		t.Error("expected an error retrieving a connection without factory")
+	}
+	if _, err := (&gornir.Host{Hostname: "broken"}).GetConnection("counting"); err == nil {
+		t.Error("expected an error opening a connection")
+	}
+
+	if err := host.CloseConnection(context.Background(), "counting"); err != nil {
+		t.Fatal(err)
+	}
+	if !factory.conns[0].isClosed() {
+		t.Error("connection wasn't closed")
+	}
+	// a new connection should be opened after closing the previous one
+	if _, err := host.GetConnection("counting"); err != nil {
+		t.Fatal(err)
+	}
+	if factory.opened != 3 {
+		t.Errorf("connection was opened %d times, expected 3", factory.opened)
+	}
+}
+
+func TestGornirClose(t *testing.T) {
+	factory := &countingFactory{}
+	gornir.RegisterConnection("counting", factory.open)
+
+	inv := gornir.Inventory{
+		Hosts: map[string]*gornir.Host{
+			"host1": {Hostname: "host1"},
+			"host2": {Hostname: "host2"},
+			"host3": {Hostname: "host3"},
+		},
+	}
+	gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Parallel())
+
+	// we run the task twice, connections should be reused
+	for i := 0; i < 2; i++ {
+		results, err := gr.RunSync(context.Background(), &connectionTask{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := gornir.Aggregate(results).RaiseOnError(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if factory.opened != 3 {
+		t.Errorf("connections were opened %d times, expected 3", factory.opened)
+	}
+
+	if err := gr.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, conn := range factory.conns {
+		if !conn.isClosed() {
+			t.Error("connection wasn't closed")
+		}
+	}
+}
+
+func TestDeadConnection(t *testing.T) {
+	factory := &countingFactory{}
+	gornir.RegisterConnection("counting", factory.open)
+
+	host := &gornir.Host{Hostname: "host1"}
+	conn, err := host.GetConnection("counting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory.conns[0].kill()
+
+	// the dead connection should be closed and replaced, only once
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := host.GetConnection("counting")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if c == conn {
+				t.Error("got the dead connection")
+			}
+		}()
+	}
+	wg.Wait()
+	if factory.opened != 2 {
+		t.Errorf("connection was opened %d times, expected 2", factory.opened)
+	}
+	if !factory.conns[0].isClosed() {
+		t.Error("dead connection wasn't closed")
+	}
+}
+
+// reopeningConnection is a fakeConnection that knows how to reopen itself
+type reopeningConnection struct {
+	*fakeConnection
+	reopened int32
+}
+
+func (c *reopeningConnection) Reopen(ctx context.Context, host *gornir.Host) (gornir.Connection, error) {
+	atomic.AddInt32(&c.reopened, 1)
+	return &fakeConnection{}, nil
+}
+
+func TestReopenConnection(t *testing.T) {
+	factory := &countingFactory{}
+	gornir.RegisterConnection("counting", factory.open)
+
+	// connections that know how they were opened are reopened the same way
+	// instead of with the registered factory
+	host := &gornir.Host{Hostname: "host1"}
+	conn := &reopeningConnection{fakeConnection: &fakeConnection{}}
+	host.SetConnection("counting", conn)
+	conn.kill()
+
+	c, err := host.GetConnection("counting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == conn {
+		t.Error("got the dead connection")
+	}
+	if conn.reopened != 1 {
+		t.Errorf("connection was reopened %d times, expected 1", conn.reopened)
+	}
+	if factory.opened != 0 {
+		t.Errorf("factory opened %d connections, expected none", factory.opened)
+	}
+	if !conn.isClosed() {
+		t.Error("dead connection wasn't closed")
+	}
+}
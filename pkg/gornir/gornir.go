@@ -5,6 +5,7 @@ package gornir
 import (
 	"context"
 	"reflect"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -17,6 +18,10 @@ type Gornir struct {
 	Runner     Runner     // Runner that will be used to run the task
 	Processors Processors // Processors to be used during the execution
 	uuid       string     // uuid is a unique identifier used across the logs to match events
+
+	failurePolicy FailurePolicy // failurePolicy defines how many TaskInstances can fail
+	retryPolicy   *RetryPolicy  // retryPolicy defines how failed TaskInstances are retried
+	timeout       time.Duration // timeout is the default timeout for each TaskInstance
 }
 
 // New is a Gornir constructor. It is currently no different that new,
@@ -34,6 +39,10 @@ func (gr *Gornir) Clone() *Gornir {
 		Logger:     gr.Logger,
 		Runner:     gr.Runner,
 		Processors: gr.Processors,
+
+		failurePolicy: gr.failurePolicy,
+		retryPolicy:   gr.retryPolicy,
+		timeout:       gr.timeout,
 	}
 }
 
@@ -44,9 +53,11 @@ func (gr *Gornir) WithRunner(rnr Runner) *Gornir {
 	return c
 }
 
-// WithInventory returns a clone of the current Gornir but with the given inventory
+// WithInventory returns a clone of the current Gornir but with the given inventory.
+// The Name of each host is set to the key it's stored under in the inventory
 func (gr *Gornir) WithInventory(inv Inventory) *Gornir {
 	c := gr.Clone()
+	inv.setNames()
 	c.Inventory = &inv
 	return c
 }
@@ -89,6 +100,33 @@ func (gr *Gornir) WithUUID(u string) *Gornir {
 	return c
 }
 
+// WithFailurePolicy returns a clone of the current Gornir but with the given FailurePolicy
+func (gr *Gornir) WithFailurePolicy(p FailurePolicy) *Gornir {
+	c := gr.Clone()
+	c.failurePolicy = p
+	return c
+}
+
+// WithRetryPolicy returns a clone of the current Gornir but with the given RetryPolicy.
+// Tasks can override it by setting TaskMetadata.RetryPolicy
+func (gr *Gornir) WithRetryPolicy(p RetryPolicy) *Gornir {
+	c := gr.Clone()
+	c.retryPolicy = &p
+	return c
+}
+
+// WithTimeout returns a clone of the current Gornir but with the given timeout for each
+// TaskInstance. Tasks can override it by setting TaskMetadata.Timeout. The timeout applies
+// to each attempt so, with a RetryPolicy, a TaskInstance can take up to RetryPolicy.Attempts
+// times the timeout plus the backoffs. Use a context with a deadline to bound the whole run.
+// Attempts that exceed the timeout are abandoned but tasks that don't check the context
+// might keep running, on the same host, while the next attempt does
+func (gr *Gornir) WithTimeout(timeout time.Duration) *Gornir {
+	c := gr.Clone()
+	c.timeout = timeout
+	return c
+}
+
 // UUID returns either the user defined uuid (if set) or a randomized one
 func (gr *Gornir) UUID() string {
 	if gr.uuid == "" {
@@ -98,11 +136,15 @@ func (gr *Gornir) UUID() string {
 }
 
 // RunSync will execute the task over the hosts in the inventory using the given runner.
-// This function will block until all the tasks are completed.
+// This function will block until all the tasks are completed. The returned channel
+// is already closed and can be turned into an AggregatedResult with Aggregate.
 // Note: It is up to the underlying task to check if the context is done
 func (gr *Gornir) RunSync(ctx context.Context, task Task) (chan *JobResult, error) {
 	logger := gr.Logger.WithField("ID", gr.UUID()).WithField("runFunc", getTaskName(task))
 
+	ctx, run := gr.newRun(ctx)
+	defer run.cancel()
+
 	results := make(chan *JobResult, len(gr.Inventory.Hosts))
 	defer close(results)
 
@@ -142,12 +184,17 @@ func (gr *Gornir) RunSync(ctx context.Context, task Task) (chan *JobResult, erro
 
 // RunAsync will execute the task over the hosts in the inventory using the given runner.
 // This function doesn't block, the user can use the method Runnner.Wait instead.
-// It's also up to the user to ensure the channel is closed and that Processors.TaskCompleted is called
+// It's also up to the user to ensure the channel is closed and that Processors.TaskCompleted is called.
+// The context passed to the tasks is cancelled once a TaskInstance has finished for each of
+// the hosts, which is the case for all the runners calling TaskWrapper or SkipTask per host
 // Note: It is up to the underlying task to check if the context is done
 func (gr *Gornir) RunAsync(ctx context.Context, task Task, results chan *JobResult) error {
 	logger := gr.Logger.WithField("ID", gr.UUID()).WithField("runFunc", getTaskName(task))
 
+	ctx, run := gr.newRun(ctx)
+
 	if err := gr.Processors.TaskStarted(ctx, logger, task); err != nil {
+		run.cancel()
 		err = errors.Wrap(err, "problem running TaskStart")
 		logger.Error(err.Error())
 		return err
@@ -162,10 +209,14 @@ func (gr *Gornir) RunAsync(ctx context.Context, task Task, results chan *JobResu
 		results,
 	)
 	if err != nil {
+		run.cancel()
 		err = errors.Wrap(err, "problem calling runner")
 		logger.Error(err.Error())
 		return err
 	}
+	if len(gr.Inventory.Hosts) == 0 {
+		run.cancel()
+	}
 
 	if err := gr.Processors.TaskCompleted(ctx, logger, task); err != nil {
 		err = errors.Wrap(err, "problem running TaskCompleted")
@@ -176,6 +227,21 @@ func (gr *Gornir) RunAsync(ctx context.Context, task Task, results chan *JobResu
 	return nil
 }
 
+// Close closes all the connections opened on all the hosts of the inventory. If any
+// connection fails to close an AggregatedError with the errors per host is returned
+func (gr *Gornir) Close(ctx context.Context) error {
+	errs := make(AggregatedError)
+	for hostname, host := range gr.Inventory.Hosts {
+		if err := host.CloseConnections(ctx); err != nil {
+			errs[hostname] = err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
 func getTaskName(i interface{}) string {
 	t := reflect.TypeOf(i)
 	if t.Kind() == reflect.Ptr {
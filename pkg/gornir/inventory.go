@@ -1,24 +1,85 @@
 package gornir
 
 import (
+	"context"
+	"strings"
+	"sync"
+
 	"github.com/pkg/errors"
 )
 
 // Host represent a host
 type Host struct {
-	err         error
-	Port        uint16                 `yaml:"port"`     // Port to connect to
-	Hostname    string                 `yaml:"hostname"` // Hostname/FQDN/IP to connect to
-	Username    string                 `yaml:"username"` // Username to use for authentication purposes
-	Password    string                 `yaml:"password"` // Password to use for authentication purposes
-	Platform    string                 `yaml:"platform"` // Platform of the device
-	Data        map[string]interface{} `yaml:"data"`     // Data belonging to the host
-	connections map[string]Connection
+	err               error
+	Name              string                       `yaml:"-"`                  // Name of the host in the inventory, set by Inventory.Link and Gornir.WithInventory
+	Port              uint16                       `yaml:"port"`               // Port to connect to
+	Hostname          string                       `yaml:"hostname"`           // Hostname/FQDN/IP to connect to
+	Username          string                       `yaml:"username"`           // Username to use for authentication purposes
+	Password          string                       `yaml:"password"`           // Password to use for authentication purposes
+	Platform          string                       `yaml:"platform"`           // Platform of the device
+	Groups            []string                     `yaml:"groups"`             // Groups the host belongs to, in order of precedence
+	Data              map[string]interface{}       `yaml:"data"`               // Data belonging to the host
+	ConnectionOptions map[string]ConnectionOptions `yaml:"connection_options"` // Parameters overridden per connection, i.e. "ssh"
+	connections       map[string]Connection
+	opening           map[string]chan struct{} // connections being opened by a ConnectionFactory
+	connMux           sync.Mutex               // connMux guards connections and opening
+	state             map[string]interface{}   // state shared by the tasks running on the host
+	mux               sync.RWMutex             // mux guards err and state
+	groups            []*Group                 // groups resolved by Inventory.Link
+	defaults          *Defaults                // defaults resolved by Inventory.Link
+}
+
+// Group represents a group of hosts. Hosts belonging to a group inherit
+// any parameter or data they don't set themselves from the group
+type Group struct {
+	Port              uint16                       `yaml:"port"`               // Port to connect to
+	Hostname          string                       `yaml:"hostname"`           // Hostname/FQDN/IP to connect to
+	Username          string                       `yaml:"username"`           // Username to use for authentication purposes
+	Password          string                       `yaml:"password"`           // Password to use for authentication purposes
+	Platform          string                       `yaml:"platform"`           // Platform of the devices
+	Groups            []string                     `yaml:"groups"`             // Groups the group belongs to, in order of precedence
+	Data              map[string]interface{}       `yaml:"data"`               // Data belonging to the group
+	ConnectionOptions map[string]ConnectionOptions `yaml:"connection_options"` // Parameters overridden per connection, i.e. "ssh"
+	groups            []*Group                     // groups resolved by Inventory.Link
+}
+
+// Defaults are the parameters and data used when neither a host nor any of
+// its groups set them
+type Defaults struct {
+	Port              uint16                       `yaml:"port"`               // Port to connect to
+	Hostname          string                       `yaml:"hostname"`           // Hostname/FQDN/IP to connect to
+	Username          string                       `yaml:"username"`           // Username to use for authentication purposes
+	Password          string                       `yaml:"password"`           // Password to use for authentication purposes
+	Platform          string                       `yaml:"platform"`           // Platform of the devices
+	Data              map[string]interface{}       `yaml:"data"`               // Data shared by all the hosts
+	ConnectionOptions map[string]ConnectionOptions `yaml:"connection_options"` // Parameters overridden per connection, i.e. "ssh"
+}
+
+// ConnectionOptions are the parameters to use for a specific connection. Parameters
+// that are not set fall back to the ones of the host, see Host.GetConnectionOptions
+type ConnectionOptions struct {
+	Port     uint16                 `yaml:"port"`     // Port to connect to
+	Hostname string                 `yaml:"hostname"` // Hostname/FQDN/IP to connect to
+	Username string                 `yaml:"username"` // Username to use for authentication purposes
+	Password string                 `yaml:"password"` // Password to use for authentication purposes
+	Platform string                 `yaml:"platform"` // Platform of the device
+	Extras   map[string]interface{} `yaml:"extras"`   // Extra parameters specific to the connection
 }
 
 // Inventory represents a collection of Hosts
 type Inventory struct {
-	Hosts map[string]*Host // Hosts represents a collection of Hosts
+	Hosts    map[string]*Host  // Hosts represents a collection of Hosts
+	Groups   map[string]*Group // Groups hosts and other groups can belong to
+	Defaults *Defaults         // Defaults for everything hosts and groups don't set
+}
+
+// setNames sets the Name of the hosts to the key they are stored under
+func (i *Inventory) setNames() {
+	for name, host := range i.Hosts {
+		if host != nil {
+			host.Name = name
+		}
+	}
 }
 
 // FilterFunc is a function that can be used to filter the inventory
@@ -28,7 +89,9 @@ type FilterFunc func(*Host) bool
 // Inventory instance but with only the hosts that passed the filter
 func (i *Inventory) Filter(f FilterFunc) *Inventory {
 	filtered := &Inventory{
-		Hosts: make(map[string]*Host),
+		Hosts:    make(map[string]*Host),
+		Groups:   i.Groups,
+		Defaults: i.Defaults,
 	}
 	for hostname, host := range i.Hosts {
 		if f(host) {
@@ -38,31 +101,487 @@ func (i *Inventory) Filter(f FilterFunc) *Inventory {
 	return filtered
 }
 
+// Link resolves the groups hosts and groups belong to and attaches the defaults
+// to each host so parameters and data can be inherited. Inheritance follows the
+// order host -> groups (in order, recursively) -> defaults.
+// Link needs to be called again if the groups or the defaults are modified.
+func (i *Inventory) Link() error {
+	for name, group := range i.Groups {
+		if group == nil {
+			return errors.Errorf("problem linking group '%s': group is nil", name)
+		}
+		parents, err := i.lookupGroups(group.Groups)
+		if err != nil {
+			return errors.Wrapf(err, "problem linking group '%s'", name)
+		}
+		group.groups = parents
+	}
+	for name := range i.Groups {
+		if err := i.checkCycles(name, []string{}); err != nil {
+			return err
+		}
+	}
+	for name, host := range i.Hosts {
+		if host == nil {
+			return errors.Errorf("problem linking host '%s': host is nil", name)
+		}
+		groups, err := i.lookupGroups(host.Groups)
+		if err != nil {
+			return errors.Wrapf(err, "problem linking host '%s'", name)
+		}
+		host.Name = name
+		host.groups = groups
+		host.defaults = i.Defaults
+	}
+	return nil
+}
+
+func (i *Inventory) lookupGroups(names []string) ([]*Group, error) {
+	groups := make([]*Group, len(names))
+	for n, name := range names {
+		group, ok := i.Groups[name]
+		if !ok {
+			return nil, errors.Errorf("unknown group '%s'", name)
+		}
+		groups[n] = group
+	}
+	return groups, nil
+}
+
+// checkCycles makes sure a group doesn't end up being its own parent
+func (i *Inventory) checkCycles(name string, path []string) error {
+	for _, p := range path {
+		if p == name {
+			return errors.Errorf("group cycle detected: %s", strings.Join(append(path, name), " -> "))
+		}
+	}
+	for _, parent := range i.Groups[name].Groups {
+		if err := i.checkCycles(parent, append(path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parentGroups returns the groups and their parents in order of precedence
+func (g *Group) parentGroups() []*Group {
+	groups := []*Group{}
+	for _, p := range g.groups {
+		groups = append(groups, p)
+		groups = append(groups, p.parentGroups()...)
+	}
+	return groups
+}
+
+// ParentGroups returns the groups the host inherits from, directly or through
+// other groups, in order of precedence
+func (h *Host) ParentGroups() []*Group {
+	groups := []*Group{}
+	for _, g := range h.groups {
+		groups = append(groups, g)
+		groups = append(groups, g.parentGroups()...)
+	}
+	return groups
+}
+
+// GetPort returns the port of the host resolving the inheritance if needed
+func (h *Host) GetPort() uint16 {
+	if h.Port != 0 {
+		return h.Port
+	}
+	for _, g := range h.ParentGroups() {
+		if g.Port != 0 {
+			return g.Port
+		}
+	}
+	if h.defaults != nil {
+		return h.defaults.Port
+	}
+	return 0
+}
+
+// GetHostname returns the hostname of the host resolving the inheritance if needed
+func (h *Host) GetHostname() string {
+	if h.Hostname != "" {
+		return h.Hostname
+	}
+	for _, g := range h.ParentGroups() {
+		if g.Hostname != "" {
+			return g.Hostname
+		}
+	}
+	if h.defaults != nil {
+		return h.defaults.Hostname
+	}
+	return ""
+}
+
+// GetUsername returns the username of the host resolving the inheritance if needed
+func (h *Host) GetUsername() string {
+	if h.Username != "" {
+		return h.Username
+	}
+	for _, g := range h.ParentGroups() {
+		if g.Username != "" {
+			return g.Username
+		}
+	}
+	if h.defaults != nil {
+		return h.defaults.Username
+	}
+	return ""
+}
+
+// GetPassword returns the password of the host resolving the inheritance if needed
+func (h *Host) GetPassword() string {
+	if h.Password != "" {
+		return h.Password
+	}
+	for _, g := range h.ParentGroups() {
+		if g.Password != "" {
+			return g.Password
+		}
+	}
+	if h.defaults != nil {
+		return h.defaults.Password
+	}
+	return ""
+}
+
+// GetPlatform returns the platform of the host resolving the inheritance if needed
+func (h *Host) GetPlatform() string {
+	if h.Platform != "" {
+		return h.Platform
+	}
+	for _, g := range h.ParentGroups() {
+		if g.Platform != "" {
+			return g.Platform
+		}
+	}
+	if h.defaults != nil {
+		return h.defaults.Platform
+	}
+	return ""
+}
+
+// connectionOptions returns the ConnectionOptions set for the connection name by the
+// host, its groups and the defaults, in order of precedence
+func (h *Host) connectionOptions(name string) []ConnectionOptions {
+	opts := []ConnectionOptions{}
+	if o, ok := h.ConnectionOptions[name]; ok {
+		opts = append(opts, o)
+	}
+	for _, g := range h.ParentGroups() {
+		if o, ok := g.ConnectionOptions[name]; ok {
+			opts = append(opts, o)
+		}
+	}
+	if h.defaults != nil {
+		if o, ok := h.defaults.ConnectionOptions[name]; ok {
+			opts = append(opts, o)
+		}
+	}
+	return opts
+}
+
+// GetConnectionOptions returns the parameters to use for the given connection. Each
+// parameter is looked up in the ConnectionOptions of the host, its groups and the
+// defaults, in that order, falling back to the parameter of the host (i.e. GetPort)
+// if none of them set it. Extras are merged following the same order of precedence
+func (h *Host) GetConnectionOptions(name string) ConnectionOptions {
+	resolved := ConnectionOptions{Extras: make(map[string]interface{})}
+	opts := h.connectionOptions(name)
+	for n := len(opts) - 1; n >= 0; n-- {
+		o := opts[n]
+		if o.Port != 0 {
+			resolved.Port = o.Port
+		}
+		if o.Hostname != "" {
+			resolved.Hostname = o.Hostname
+		}
+		if o.Username != "" {
+			resolved.Username = o.Username
+		}
+		if o.Password != "" {
+			resolved.Password = o.Password
+		}
+		if o.Platform != "" {
+			resolved.Platform = o.Platform
+		}
+		for k, v := range o.Extras {
+			resolved.Extras[k] = v
+		}
+	}
+	if resolved.Port == 0 {
+		resolved.Port = h.GetPort()
+	}
+	if resolved.Hostname == "" {
+		resolved.Hostname = h.GetHostname()
+	}
+	if resolved.Username == "" {
+		resolved.Username = h.GetUsername()
+	}
+	if resolved.Password == "" {
+		resolved.Password = h.GetPassword()
+	}
+	if resolved.Platform == "" {
+		resolved.Platform = h.GetPlatform()
+	}
+	return resolved
+}
+
+// GetData returns the value of the given key looking for it in the host's Data
+// first, then in its groups and finally in the defaults
+func (h *Host) GetData(key string) (interface{}, bool) {
+	if v, ok := h.Data[key]; ok {
+		return v, true
+	}
+	for _, g := range h.ParentGroups() {
+		if v, ok := g.Data[key]; ok {
+			return v, true
+		}
+	}
+	if h.defaults != nil {
+		if v, ok := h.defaults.Data[key]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// AllData returns a new map with all the keys the host has access to,
+// either set by itself or inherited
+func (h *Host) AllData() map[string]interface{} {
+	data := make(map[string]interface{})
+	if h.defaults != nil {
+		for k, v := range h.defaults.Data {
+			data[k] = v
+		}
+	}
+	groups := h.ParentGroups()
+	for n := len(groups) - 1; n >= 0; n-- {
+		for k, v := range groups[n].Data {
+			data[k] = v
+		}
+	}
+	for k, v := range h.Data {
+		data[k] = v
+	}
+	return data
+}
+
 // SetErr stores the error in the host
 func (h *Host) SetErr(err error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
 	h.err = err
 }
 
 // Err returns the stored error
 func (h *Host) Err() error {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
 	return h.err
 }
 
+// SetState stores a value in the host so other tasks, or later runs, can
+// retrieve it with GetState. It's safe to use concurrently
+func (h *Host) SetState(key string, value interface{}) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if h.state == nil {
+		h.state = make(map[string]interface{})
+	}
+	h.state[key] = value
+}
+
+// GetState retrieves a value previously stored with SetState
+func (h *Host) GetState(key string) (interface{}, bool) {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	value, ok := h.state[key]
+	return value, ok
+}
+
+// UpdateState atomically replaces the value stored under key with the one returned by f.
+// f receives the current value and whether there was one. f must not call any
+// other state method of the host
+func (h *Host) UpdateState(key string, f func(value interface{}, ok bool) interface{}) interface{} {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if h.state == nil {
+		h.state = make(map[string]interface{})
+	}
+	value, ok := h.state[key]
+	h.state[key] = f(value, ok)
+	return h.state[key]
+}
+
+// DeleteState removes the value stored under key
+func (h *Host) DeleteState(key string) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	delete(h.state, key)
+}
+
 // SetConnections stores a connection
 func (h *Host) SetConnection(name string, conn Connection) {
+	h.SetConnectionContext(context.Background(), name, conn) // nolint
+}
+
+// SetConnectionContext stores a connection opened by the task running with ctx. If the task
+// exceeds its timeout, the connection is closed and removed from the host. If the task was
+// already abandoned the connection is closed instead of stored and an error is returned
+func (h *Host) SetConnectionContext(ctx context.Context, name string, conn Connection) error {
+	h.connMux.Lock()
+	defer h.connMux.Unlock()
+	if !getAttemptConnections(ctx).add(name, conn) {
+		conn.Close(context.Background()) // nolint
+		return errors.Errorf("problem storing connection '%s': the task was abandoned", name)
+	}
 	if h.connections == nil {
 		h.connections = make(map[string]Connection)
 	}
 	h.connections[name] = conn
+	return nil
 }
 
-// GetConnection retrieves a connection that was previously set
+// GetConnection retrieves a connection that was previously set. If there
+// is none it opens a new one using the ConnectionFactory registered with
+// the same name, see GetConnectionContext
 func (h *Host) GetConnection(name string) (Connection, error) {
+	return h.GetConnectionContext(context.Background(), name)
+}
+
+// GetConnectionContext retrieves a connection that was previously set. If there
+// is none and a ConnectionFactory was registered with the same name, the factory is
+// used to open the connection, which is stored in the host so subsequent tasks reuse it.
+// Connections implementing HealthChecker that are found dead are closed and reopened,
+// with the same settings if they implement Reopener.
+// It's safe to call it concurrently, the connection will only be opened once
+func (h *Host) GetConnectionContext(ctx context.Context, name string) (Connection, error) {
+	var factory ConnectionFactory
+	for {
+		h.connMux.Lock()
+		if c, ok := h.connections[name]; ok {
+			h.connMux.Unlock()
+			if isAlive(ctx, c) {
+				return c, nil
+			}
+			if ctx.Err() != nil {
+				// the check was interrupted, that doesn't mean the connection is dead
+				return nil, errors.Wrap(ctx.Err(), "problem checking connection")
+			}
+			h.discardConnection(ctx, name, c)
+			if r, ok := c.(Reopener); ok {
+				factory = r.Reopen
+			}
+			continue
+		}
+		opening, ok := h.opening[name]
+		if !ok {
+			break
+		}
+		// someone else is opening the connection, we wait and check again
+		h.connMux.Unlock()
+		select {
+		case <-opening:
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "problem waiting for connection to be opened")
+		}
+	}
+
+	if factory == nil {
+		var ok bool
+		if factory, ok = getConnectionFactory(name); !ok {
+			h.connMux.Unlock()
+			return nil, errors.New("couldn't find connection")
+		}
+	}
+	if h.opening == nil {
+		h.opening = make(map[string]chan struct{})
+	}
+	opening := make(chan struct{})
+	h.opening[name] = opening
+	h.connMux.Unlock()
+
+	conn, err := factory(ctx, h)
+
+	h.connMux.Lock()
+	defer h.connMux.Unlock()
+	delete(h.opening, name)
+	close(opening)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening connection '%s'", name)
+	}
+	if !getAttemptConnections(ctx).add(name, conn) {
+		conn.Close(context.Background()) // nolint
+		return nil, errors.Errorf("problem opening connection '%s': the task was abandoned", name)
+	}
 	if h.connections == nil {
 		h.connections = make(map[string]Connection)
 	}
-	if c, ok := h.connections[name]; ok {
-		return c, nil
+	h.connections[name] = conn
+	return conn, nil
+}
+
+// discardConnection removes the connection with the given name, if it's still conn, and closes it
+func (h *Host) discardConnection(ctx context.Context, name string, conn Connection) {
+	h.connMux.Lock()
+	current, ok := h.connections[name]
+	if !ok || current != conn {
+		// someone else discarded it already
+		h.connMux.Unlock()
+		return
+	}
+	delete(h.connections, name)
+	h.connMux.Unlock()
+	conn.Close(ctx) // nolint
+}
+
+// CloseConnection closes the connection with the given name and removes it from the host
+func (h *Host) CloseConnection(ctx context.Context, name string) error {
+	h.connMux.Lock()
+	conn, ok := h.connections[name]
+	delete(h.connections, name)
+	h.connMux.Unlock()
+	if !ok {
+		return errors.New("couldn't find connection")
+	}
+	return conn.Close(ctx)
+}
+
+// CloseConnections closes all the connections of the host and removes them
+func (h *Host) CloseConnections(ctx context.Context) error {
+	errs := h.closeConnectionsExcept(ctx, nil)
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// closeConnectionsExcept closes and removes the connections of the host that are not
+// part of the given set, returning the errors found along the way
+func (h *Host) closeConnectionsExcept(ctx context.Context, keep map[string]Connection) []error {
+	h.connMux.Lock()
+	toClose := make(map[string]Connection)
+	for name, conn := range h.connections {
+		if k, ok := keep[name]; !ok || k != conn {
+			toClose[name] = conn
+			delete(h.connections, name)
+		}
+	}
+	h.connMux.Unlock()
+
+	errs := []error{}
+	for name, conn := range toClose {
+		if err := conn.Close(ctx); err != nil {
+			errs = append(errs, errors.Wrapf(err, "problem closing connection '%s'", name))
+		}
 	}
-	return nil, errors.New("couldn't find connection")
+	return errs
 }
@@ -0,0 +1,233 @@
+package gornir_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testInventory() gornir.Inventory {
+	return gornir.Inventory{
+		Hosts: map[string]*gornir.Host{
+			"dev1": {
+				Hostname: "dev1",
+				Groups:   []string{"site_a", "ios"},
+				Data:     map[string]interface{}{"role": "leaf"},
+			},
+			"dev2": {
+				Hostname: "dev2",
+				Port:     2222,
+				Username: "admin",
+				Groups:   []string{"ios"},
+			},
+			"dev3": {
+				Hostname: "dev3",
+			},
+		},
+		Groups: map[string]*gornir.Group{
+			"site_a": {
+				Username: "site_a_user",
+				Groups:   []string{"core"},
+				Data:     map[string]interface{}{"site": "a", "role": "spine"},
+			},
+			"core": {
+				Password: "core_password",
+				Data:     map[string]interface{}{"vrf": "core"},
+			},
+			"ios": {
+				Platform: "ios",
+				Password: "ios_password",
+				Data:     map[string]interface{}{"vrf": "mgmt"},
+			},
+		},
+		Defaults: &gornir.Defaults{
+			Port:     22,
+			Username: "root",
+			Password: "docker",
+			Platform: "linux",
+			Data:     map[string]interface{}{"ntp": "10.0.0.1"},
+		},
+	}
+}
+
+func TestInheritance(t *testing.T) {
+	inv := testInventory()
+	if err := inv.Link(); err != nil {
+		t.Fatal(err)
+	}
+
+	type params struct {
+		Port     uint16
+		Username string
+		Password string
+		Platform string
+	}
+	testCases := []struct {
+		name     string
+		expected params
+		data     map[string]interface{}
+	}{
+		{
+			name:     "dev1",
+			expected: params{Port: 22, Username: "site_a_user", Password: "core_password", Platform: "ios"},
+			data:     map[string]interface{}{"role": "leaf", "site": "a", "vrf": "core", "ntp": "10.0.0.1"},
+		},
+		{
+			name:     "dev2",
+			expected: params{Port: 2222, Username: "admin", Password: "ios_password", Platform: "ios"},
+			data:     map[string]interface{}{"vrf": "mgmt", "ntp": "10.0.0.1"},
+		},
+		{
+			name:     "dev3",
+			expected: params{Port: 22, Username: "root", Password: "docker", Platform: "linux"},
+			data:     map[string]interface{}{"ntp": "10.0.0.1"},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			host := inv.Hosts[tc.name]
+			got := params{
+				Port:     host.GetPort(),
+				Username: host.GetUsername(),
+				Password: host.GetPassword(),
+				Platform: host.GetPlatform(),
+			}
+			if !cmp.Equal(got, tc.expected) {
+				t.Error(cmp.Diff(got, tc.expected))
+			}
+			if !cmp.Equal(host.AllData(), tc.data) {
+				t.Error(cmp.Diff(host.AllData(), tc.data))
+			}
+			for k, v := range tc.data {
+				if got, ok := host.GetData(k); !ok || got != v {
+					t.Errorf("GetData(%s): got %v, want %v", k, got, v)
+				}
+			}
+			if _, ok := host.GetData("missing"); ok {
+				t.Error("GetData returned a key that doesn't exist")
+			}
+		})
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	unknown := testInventory()
+	unknown.Hosts["dev3"].Groups = []string{"nope"}
+
+	cycle := testInventory()
+	cycle.Groups["core"].Groups = []string{"site_a"}
+
+	nilGroup := testInventory()
+	nilGroup.Groups["core"] = nil
+
+	nilHost := testInventory()
+	nilHost.Hosts["dev3"] = nil
+
+	testCases := []struct {
+		name string
+		inv  gornir.Inventory
+		err  string
+	}{
+		{"unknown group", unknown, "problem linking host 'dev3': unknown group 'nope'"},
+		{"group cycle", cycle, "group cycle detected: "},
+		{"nil group", nilGroup, "problem linking group 'core': group is nil"},
+		{"nil host", nilHost, "problem linking host 'dev3': host is nil"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.inv.Link()
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.HasPrefix(err.Error(), tc.err) {
+				t.Errorf("got %q, want prefix %q", err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+func TestConnectionOptions(t *testing.T) {
+	inv := testInventory()
+	inv.Hosts["dev1"].ConnectionOptions = map[string]gornir.ConnectionOptions{
+		"netconf": {Username: "netconf_user", Extras: map[string]interface{}{"timeout": 30}},
+	}
+	inv.Groups["ios"].ConnectionOptions = map[string]gornir.ConnectionOptions{
+		"netconf": {Port: 830, Username: "ios_netconf", Extras: map[string]interface{}{"timeout": 10, "hostkey_verify": false}},
+		"http":    {Port: 443, Platform: "ios_api"},
+	}
+	inv.Defaults.ConnectionOptions = map[string]gornir.ConnectionOptions{
+		"ssh": {Password: "ssh_password"},
+	}
+	if err := inv.Link(); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		host       string
+		connection string
+		expected   gornir.ConnectionOptions
+	}{
+		{
+			host:       "dev1",
+			connection: "netconf",
+			expected: gornir.ConnectionOptions{
+				Port:     830,
+				Hostname: "dev1",
+				Username: "netconf_user",
+				Password: "core_password",
+				Platform: "ios",
+				Extras:   map[string]interface{}{"timeout": 30, "hostkey_verify": false},
+			},
+		},
+		{
+			host:       "dev2",
+			connection: "http",
+			expected: gornir.ConnectionOptions{
+				Port:     443,
+				Hostname: "dev2",
+				Username: "admin",
+				Password: "ios_password",
+				Platform: "ios_api",
+				Extras:   map[string]interface{}{},
+			},
+		},
+		{
+			host:       "dev2",
+			connection: "ssh",
+			expected: gornir.ConnectionOptions{
+				Port:     2222,
+				Hostname: "dev2",
+				Username: "admin",
+				Password: "ssh_password",
+				Platform: "ios",
+				Extras:   map[string]interface{}{},
+			},
+		},
+		{
+			host:       "dev3",
+			connection: "unknown",
+			expected: gornir.ConnectionOptions{
+				Port:     22,
+				Hostname: "dev3",
+				Username: "root",
+				Password: "docker",
+				Platform: "linux",
+				Extras:   map[string]interface{}{},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.host+"/"+tc.connection, func(t *testing.T) {
+			got := inv.Hosts[tc.host].GetConnectionOptions(tc.connection)
+			if !cmp.Equal(got, tc.expected) {
+				t.Error(cmp.Diff(got, tc.expected))
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package gornir
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// EmitOutput delivers a line of output of the TaskInstance being executed to the Processors
+// implementing OutputProcessor. ctx must be the one passed to the Run method of the task,
+// otherwise the line is discarded. Output of subtasks is attributed to the subtask
+func EmitOutput(ctx context.Context, logger Logger, host *Host, stream, line string) error {
+	ti := getTaskInstance(ctx)
+	if ti == nil {
+		return nil
+	}
+	return ti.processors.TaskInstanceOutput(ctx, logger, host, ti.task, stream, line)
+}
+
+// EmitProgress reports the progress of the TaskInstance being executed on item to the
+// Processors implementing ProgressProcessor. Like with EmitOutput, ctx must be the one
+// passed to the Run method of the task, otherwise the progress is discarded
+func EmitProgress(ctx context.Context, logger Logger, host *Host, item string, done, total int64) error {
+	ti := getTaskInstance(ctx)
+	if ti == nil {
+		return nil
+	}
+	return ti.processors.TaskInstanceProgress(ctx, logger, host, ti.task, item, done, total)
+}
+
+// outputWriter splits what's written to it in lines and emits them with EmitOutput
+type outputWriter struct {
+	ctx    context.Context
+	logger Logger
+	host   *Host
+	stream string
+	mux    sync.Mutex
+	buf    bytes.Buffer // incomplete line
+}
+
+// OutputWriter returns a writer that delivers what's written to it, line by line, to the
+// Processors implementing OutputProcessor, see EmitOutput. Errors returned by the
+// Processors are logged and don't interrupt the writes. Close needs to be called to
+// deliver the last line if it doesn't end with a new line
+func OutputWriter(ctx context.Context, logger Logger, host *Host, stream string) io.WriteCloser {
+	return &outputWriter{ctx: ctx, logger: logger, host: host, stream: stream}
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := w.buf.Next(i + 1)
+		w.emit(string(bytes.TrimRight(line, "\r\n")))
+	}
+}
+
+// Close delivers the last line, if any
+func (w *outputWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.buf.Len() > 0 {
+		w.emit(w.buf.String())
+		w.buf.Reset()
+	}
+	return nil
+}
+
+func (w *outputWriter) emit(line string) {
+	if err := EmitOutput(w.ctx, w.logger, w.host, w.stream, line); err != nil {
+		w.logger.Error(err.Error())
+	}
+}
@@ -0,0 +1,89 @@
+package gornir_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/logger"
+	"github.com/nornir-automation/gornir/pkg/plugins/runner"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// outputTask writes its name to stdout and, if set, runs sub as a subtask
+type outputTask struct {
+	name string
+	sub  gornir.Task
+}
+
+func (t *outputTask) Metadata() *gornir.TaskMetadata {
+	return &gornir.TaskMetadata{Identifier: t.name}
+}
+
+func (t *outputTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	w := gornir.OutputWriter(ctx, logger, host, "stdout")
+	defer w.Close() // nolint
+	if _, err := w.Write([]byte("hello from\n" + t.name)); err != nil {
+		return nil, err
+	}
+	if t.sub != nil {
+		if _, err := gornir.RunSubtask(ctx, logger, host, t.sub); err != nil {
+			return nil, err
+		}
+	}
+	return nil, gornir.EmitOutput(ctx, logger, host, "stderr", "bye")
+}
+
+// outputProcessor records the output of the tasks
+type outputProcessor struct {
+	dummyProcessor
+	lines []string
+}
+
+func (r *outputProcessor) TaskInstanceOutput(ctx context.Context, logger gornir.Logger, host *gornir.Host, task gornir.Task, stream, line string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.lines = append(r.lines, host.Hostname+" "+gornir.TaskName(task)+" "+stream+": "+line)
+	return nil
+}
+
+func TestOutput(t *testing.T) {
+	inv := gornir.Inventory{
+		Hosts: map[string]*gornir.Host{
+			"host1": {Hostname: "host1"},
+		},
+	}
+	processor := &outputProcessor{dummyProcessor: *dummy(make(map[string]interface{}))}
+	gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Sorted()).WithProcessor(processor)
+
+	task := &outputTask{name: "parent", sub: &outputTask{name: "child"}}
+	results, err := gr.RunSync(context.Background(), task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gornir.Aggregate(results).RaiseOnError(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the last line of the parent is only delivered when the writer is closed
+	expected := []string{
+		"host1 parent stdout: hello from",
+		"host1 child stdout: hello from",
+		"host1 child stderr: bye",
+		"host1 child stdout: child",
+		"host1 parent stderr: bye",
+		"host1 parent stdout: parent",
+	}
+	if !cmp.Equal(processor.lines, expected) {
+		t.Error(cmp.Diff(processor.lines, expected))
+	}
+
+	// output outside of a task is discarded
+	if err := gornir.EmitOutput(context.Background(), logger.NewNull(), inv.Hosts["host1"], "stdout", "lost"); err != nil {
+		t.Fatal(err)
+	}
+	if len(processor.lines) != len(expected) {
+		t.Error("output outside of a task was delivered")
+	}
+}
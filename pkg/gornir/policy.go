@@ -0,0 +1,189 @@
+package gornir
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrSkipped is the error set on the TaskInstances that were not executed
+// because the failure budget of the FailurePolicy was exhausted
+var ErrSkipped = errors.New("skipped: failure budget exhausted")
+
+// FailurePolicy defines how many TaskInstances can fail before gornir stops
+// executing the task over the remaining hosts. Once the budget is exhausted the
+// context shared by all the TaskInstances is cancelled and the hosts that haven't
+// started yet get ErrSkipped as error.
+type FailurePolicy struct {
+	MaxFailures int // Number of failed TaskInstances that exhaust the budget, 0 means no limit
+}
+
+// FailFast is a FailurePolicy that stops the execution as soon as a TaskInstance fails
+var FailFast = FailurePolicy{MaxFailures: 1}
+
+// RetryPolicy defines if and how a failed TaskInstance is retried. The time between
+// attempts grows exponentially starting at Backoff and doubling after each attempt.
+type RetryPolicy struct {
+	Attempts   int              // Maximum number of attempts, including the first one. 0 or 1 means no retries
+	Backoff    time.Duration    // Time to wait before the first retry
+	MaxBackoff time.Duration    // Maximum time to wait between attempts, 0 means no limit
+	Jitter     float64          // Fraction of the backoff, between 0 and 1, that is randomized
+	Retryable  func(error) bool // Decides if an error is worth retrying, if nil DefaultRetryable is used
+}
+
+// DefaultRetryable retries all errors except the ones caused by the context
+// being done or by the TaskInstance being skipped
+func DefaultRetryable(err error) bool {
+	switch errors.Cause(err) {
+	case context.Canceled, context.DeadlineExceeded, ErrSkipped:
+		return false
+	}
+	return true
+}
+
+// retryable returns true if the given error after the given attempt deserves another attempt
+func (p *RetryPolicy) retryable(attempt int, err error) bool {
+	if p == nil || err == nil || attempt >= p.Attempts {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return DefaultRetryable(err)
+}
+
+// backoff returns how long to wait after the given attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.Backoff) * math.Pow(2, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d -= d * p.Jitter * rand.Float64() // #nosec
+	}
+	return time.Duration(d)
+}
+
+// runState keeps track of the state shared by all the TaskInstances of a run.
+// It's passed down to TaskWrapper via the context so it works regardless of the Runner
+type runState struct {
+	policy      FailurePolicy
+	retryPolicy *RetryPolicy
+	timeout     time.Duration
+	cancel      context.CancelFunc
+	mux         *sync.Mutex
+	failures    int
+	pending     int                         // TaskInstances that haven't finished yet
+	values      map[interface{}]interface{} // values shared by the tasks, see RunValue
+}
+
+type runStateKey struct{}
+
+// newRun returns a context for a new run with its state attached. The context is
+// cancelled once a TaskInstance has finished for each of the hosts in the inventory
+func (gr *Gornir) newRun(ctx context.Context) (context.Context, *runState) {
+	state := &runState{
+		policy:      gr.failurePolicy,
+		retryPolicy: gr.retryPolicy,
+		timeout:     gr.timeout,
+		mux:         &sync.Mutex{},
+		pending:     len(gr.Inventory.Hosts),
+	}
+	ctx, state.cancel = context.WithCancel(ctx)
+	return context.WithValue(ctx, runStateKey{}, state), state
+}
+
+// getRunState returns the state of the run or nil if there is none,
+// for instance, if the Runner was called directly
+func getRunState(ctx context.Context) *runState {
+	state, _ := ctx.Value(runStateKey{}).(*runState)
+	return state
+}
+
+// RunValue returns the value stored under key for the run ctx belongs to, storing the one
+// returned by init the first time, so tasks can share state across the hosts of a run,
+// i.e. the files they parse. init is called while holding a lock so it shouldn't block.
+// Outside of a run, i.e. if the task is run directly, init is called every time
+func RunValue(ctx context.Context, key interface{}, init func() interface{}) interface{} {
+	s := getRunState(ctx)
+	if s == nil {
+		return init()
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if v, ok := s.values[key]; ok {
+		return v
+	}
+	if s.values == nil {
+		s.values = make(map[interface{}]interface{})
+	}
+	v := init()
+	s.values[key] = v
+	return v
+}
+
+// exhausted returns true if the failure budget has been exhausted
+func (s *runState) exhausted() bool {
+	if s == nil || s.policy.MaxFailures <= 0 {
+		return false
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.failures >= s.policy.MaxFailures
+}
+
+// finished accounts for a TaskInstance that finished, cancelling the
+// context of the run once all of them have
+func (s *runState) finished() {
+	if s == nil {
+		return
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.pending--
+	if s.pending <= 0 {
+		s.cancel()
+	}
+}
+
+// record accounts for the result of a TaskInstance and cancels the
+// context of the run if the failure budget is exhausted
+func (s *runState) record(err error) {
+	if s == nil || err == nil || err == ErrSkipped {
+		return
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.failures++
+	if s.policy.MaxFailures > 0 && s.failures >= s.policy.MaxFailures {
+		s.cancel()
+	}
+}
+
+// retryPolicyFor returns the RetryPolicy for the task, the one in the task's
+// metadata takes precedence over the one set for the run
+func (s *runState) retryPolicyFor(task Task) *RetryPolicy {
+	if meta := task.Metadata(); meta != nil && meta.RetryPolicy != nil {
+		return meta.RetryPolicy
+	}
+	if s == nil {
+		return nil
+	}
+	return s.retryPolicy
+}
+
+// timeoutFor returns the timeout for the task, the one in the task's
+// metadata takes precedence over the one set for the run
+func (s *runState) timeoutFor(task Task) time.Duration {
+	if meta := task.Metadata(); meta != nil && meta.Timeout > 0 {
+		return meta.Timeout
+	}
+	if s == nil {
+		return 0
+	}
+	return s.timeout
+}
@@ -0,0 +1,201 @@
+package gornir_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/logger"
+	"github.com/nornir-automation/gornir/pkg/plugins/runner"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var errFail = errors.New("failed")
+
+type failingTask struct {
+}
+
+func (t *failingTask) Metadata() *gornir.TaskMetadata {
+	return nil
+}
+
+func (t *failingTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	if host.Hostname == "host3" {
+		return nil, nil
+	}
+	return nil, errFail
+}
+
+func TestFailurePolicy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		policy   gornir.FailurePolicy
+		rnr      gornir.Runner
+		expected map[string]error
+	}{
+		{
+			name:   "no policy",
+			policy: gornir.FailurePolicy{},
+			rnr:    runner.Sorted(),
+			expected: map[string]error{
+				"host1": errFail, "host2": errFail, "host3": nil, "host4": errFail, "host5": errFail,
+			},
+		},
+		{
+			name:   "fail fast",
+			policy: gornir.FailFast,
+			rnr:    runner.Sorted(),
+			expected: map[string]error{
+				"host1": errFail, "host2": gornir.ErrSkipped, "host3": gornir.ErrSkipped, "host4": gornir.ErrSkipped, "host5": gornir.ErrSkipped,
+			},
+		},
+		{
+			name:   "max failures",
+			policy: gornir.FailurePolicy{MaxFailures: 3},
+			rnr:    runner.Sorted(),
+			expected: map[string]error{
+				"host1": errFail, "host2": errFail, "host3": nil, "host4": errFail, "host5": gornir.ErrSkipped,
+			},
+		},
+		{
+			name:   "pool runner",
+			policy: gornir.FailurePolicy{MaxFailures: 2},
+			rnr:    runner.Pool(1),
+			expected: map[string]error{
+				"host1": errFail, "host2": errFail, "host3": gornir.ErrSkipped, "host4": gornir.ErrSkipped, "host5": gornir.ErrSkipped,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			inv := gornir.Inventory{
+				Hosts: map[string]*gornir.Host{
+					"host1": {Hostname: "host1"},
+					"host2": {Hostname: "host2"},
+					"host3": {Hostname: "host3"},
+					"host4": {Hostname: "host4"},
+					"host5": {Hostname: "host5"},
+				},
+			}
+			gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(tc.rnr)
+
+			results, err := gr.WithFailurePolicy(tc.policy).RunSync(context.Background(), &failingTask{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]error)
+			for res := range results {
+				got[res.Host().Hostname] = res.Err()
+			}
+			if !cmp.Equal(got, tc.expected, cmp.Comparer(func(x, y error) bool { return x == y })) {
+				t.Errorf("got %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+// ctxTask records the context it's run with
+type ctxTask struct {
+	ctx chan context.Context
+}
+
+func (t *ctxTask) Metadata() *gornir.TaskMetadata {
+	return nil
+}
+
+func (t *ctxTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	t.ctx <- ctx
+	return nil, nil
+}
+
+func TestRunAsyncReleasesContext(t *testing.T) {
+	inv := gornir.Inventory{Hosts: map[string]*gornir.Host{"host1": {Hostname: "host1"}}}
+	gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Parallel())
+
+	task := &ctxTask{ctx: make(chan context.Context, 1)}
+	results := make(chan *gornir.JobResult, 1)
+	if err := gr.RunAsync(context.Background(), task, results); err != nil {
+		t.Fatal(err)
+	}
+	if err := gr.Runner.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	close(results)
+
+	// the context of the run is cancelled once the runner is done
+	select {
+	case <-(<-task.ctx).Done():
+	case <-time.After(time.Second):
+		t.Error("context of the run wasn't released")
+	}
+}
+
+// TestRunAsyncReuseRunner checks the runner can be reused once Wait returns
+func TestRunAsyncReuseRunner(t *testing.T) {
+	inv := gornir.Inventory{Hosts: map[string]*gornir.Host{"host1": {Hostname: "host1"}, "host2": {Hostname: "host2"}}}
+	rnr := runner.Parallel()
+	gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(rnr)
+
+	for i := 0; i < 50; i++ {
+		task := &ctxTask{ctx: make(chan context.Context, 2)}
+		results := make(chan *gornir.JobResult, 2)
+		if err := gr.RunAsync(context.Background(), task, results); err != nil {
+			t.Fatal(err)
+		}
+		if err := rnr.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		close(results)
+		for j := 0; j < 2; j++ {
+			if err := (<-task.ctx).Err(); err != context.Canceled {
+				t.Fatalf("got %v, want the context of the run to be released", err)
+			}
+		}
+	}
+}
+
+// runValueTask counts the hosts of the run using a value shared through RunValue
+type runValueTask struct {
+	inits int
+}
+
+func (t *runValueTask) Metadata() *gornir.TaskMetadata {
+	return nil
+}
+
+func (t *runValueTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	count := gornir.RunValue(ctx, t, func() interface{} {
+		t.inits++
+		return new(int)
+	}).(*int)
+	*count++
+	return *count, nil
+}
+
+func TestRunValue(t *testing.T) {
+	inv := gornir.Inventory{Hosts: map[string]*gornir.Host{"host1": {Hostname: "host1"}, "host2": {Hostname: "host2"}}}
+	gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Sorted())
+
+	task := &runValueTask{}
+	for i := 0; i < 2; i++ {
+		results, err := gr.RunSync(context.Background(), task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts := []int{}
+		for res := range results {
+			counts = append(counts, res.Data().(int))
+		}
+		if len(counts) != 2 || counts[0]+counts[1] != 3 {
+			t.Errorf("run %d: got counts %v, want the value to be shared by the hosts of the run", i, counts)
+		}
+	}
+	if task.inits != 2 {
+		t.Errorf("got %d values, want one per run", task.inits)
+	}
+}
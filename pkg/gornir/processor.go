@@ -26,6 +26,41 @@ type Processor interface {
 	TaskInstanceCompleted(context.Context, Logger, *JobResult, *Host, Task) error
 }
 
+// RetryProcessor is an optional interface a Processor can implement to be notified
+// when a TaskInstance failed and is going to be retried according to the RetryPolicy
+type RetryProcessor interface {
+	// TaskInstanceRetry is called after a failed attempt, before waiting for the next one
+	TaskInstanceRetry(ctx context.Context, logger Logger, host *Host, task Task, attempt int, err error) error
+}
+
+// SubtaskProcessor is an optional interface a Processor can implement to be notified
+// when a subtask executed with RunSubtask starts and completes
+type SubtaskProcessor interface {
+	// SubtaskStarted is called before a subtask starts
+	SubtaskStarted(ctx context.Context, logger Logger, host *Host, task Task) error
+	// SubtaskCompleted is called after a subtask completed, JobResult.Parent
+	// returns the result of the task that executed the subtask
+	SubtaskCompleted(ctx context.Context, logger Logger, jobResult *JobResult, host *Host, task Task) error
+}
+
+// OutputProcessor is an optional interface a Processor can implement to receive the output of
+// a TaskInstance as it's produced, i.e. the lines written by a long running command. Tasks
+// deliver their output with EmitOutput or OutputWriter. Note it might be called concurrently
+// for the same TaskInstance if it produces more than one stream of output
+type OutputProcessor interface {
+	// TaskInstanceOutput is called for each line of output, stream tells where it comes from, i.e. "stdout"
+	TaskInstanceOutput(ctx context.Context, logger Logger, host *Host, task Task, stream, line string) error
+}
+
+// ProgressProcessor is an optional interface a Processor can implement to be notified of the
+// progress of a TaskInstance, i.e. the bytes transferred of a file. Tasks report their
+// progress with EmitProgress
+type ProgressProcessor interface {
+	// TaskInstanceProgress is called when there is progress on the item, done and total are
+	// measured in the units of the item, i.e. bytes, total is -1 if it's unknown
+	TaskInstanceProgress(ctx context.Context, logger Logger, host *Host, task Task, item string, done, total int64) error
+}
+
 // Processors stores a list of Processor that can be called during gornir's lifetime
 // When Procerssors calls the methods of the same name of each Proccesor you have
 // to take into account that:
@@ -73,3 +108,73 @@ func (p Processors) TaskInstanceCompleted(ctx context.Context, logger Logger, jo
 	}
 	return nil
 }
+
+// TaskInstanceRetry calls the method of the same name of the Processors implementing RetryProcessor
+func (p Processors) TaskInstanceRetry(ctx context.Context, logger Logger, host *Host, task Task, attempt int, err error) error {
+	for _, p := range p {
+		rp, ok := p.(RetryProcessor)
+		if !ok {
+			continue
+		}
+		if err := rp.TaskInstanceRetry(ctx, logger, host, task, attempt, err); err != nil {
+			return errors.Wrap(err, "problem running processor during 'TaskInstanceRetry'")
+		}
+	}
+	return nil
+}
+
+// SubtaskStarted calls the method of the same name of the Processors implementing SubtaskProcessor
+func (p Processors) SubtaskStarted(ctx context.Context, logger Logger, host *Host, task Task) error {
+	for _, p := range p {
+		sp, ok := p.(SubtaskProcessor)
+		if !ok {
+			continue
+		}
+		if err := sp.SubtaskStarted(ctx, logger, host, task); err != nil {
+			return errors.Wrap(err, "problem running processor during 'SubtaskStarted'")
+		}
+	}
+	return nil
+}
+
+// SubtaskCompleted calls the method of the same name of the Processors implementing SubtaskProcessor
+func (p Processors) SubtaskCompleted(ctx context.Context, logger Logger, jobResult *JobResult, host *Host, task Task) error {
+	for _, p := range p {
+		sp, ok := p.(SubtaskProcessor)
+		if !ok {
+			continue
+		}
+		if err := sp.SubtaskCompleted(ctx, logger, jobResult, host, task); err != nil {
+			return errors.Wrap(err, "problem running processor during 'SubtaskCompleted'")
+		}
+	}
+	return nil
+}
+
+// TaskInstanceOutput calls the method of the same name of the Processors implementing OutputProcessor
+func (p Processors) TaskInstanceOutput(ctx context.Context, logger Logger, host *Host, task Task, stream, line string) error {
+	for _, p := range p {
+		op, ok := p.(OutputProcessor)
+		if !ok {
+			continue
+		}
+		if err := op.TaskInstanceOutput(ctx, logger, host, task, stream, line); err != nil {
+			return errors.Wrap(err, "problem running processor during 'TaskInstanceOutput'")
+		}
+	}
+	return nil
+}
+
+// TaskInstanceProgress calls the method of the same name of the Processors implementing ProgressProcessor
+func (p Processors) TaskInstanceProgress(ctx context.Context, logger Logger, host *Host, task Task, item string, done, total int64) error {
+	for _, p := range p {
+		pp, ok := p.(ProgressProcessor)
+		if !ok {
+			continue
+		}
+		if err := pp.TaskInstanceProgress(ctx, logger, host, task, item, done, total); err != nil {
+			return errors.Wrap(err, "problem running processor during 'TaskInstanceProgress'")
+		}
+	}
+	return nil
+}
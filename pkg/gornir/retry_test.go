@@ -0,0 +1,142 @@
+package gornir_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/logger"
+	"github.com/nornir-automation/gornir/pkg/plugins/runner"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var errFlaky = errors.New("flaky")
+
+// flakyTask fails the first "failures" attempts on each host
+type flakyTask struct {
+	failures int
+	meta     *gornir.TaskMetadata
+	mux      sync.Mutex
+	attempts map[string]int
+}
+
+func (t *flakyTask) Metadata() *gornir.TaskMetadata {
+	return t.meta
+}
+
+func (t *flakyTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if t.attempts == nil {
+		t.attempts = make(map[string]int)
+	}
+	t.attempts[host.Hostname]++
+	if t.attempts[host.Hostname] <= t.failures {
+		return nil, errFlaky
+	}
+	return dummyTaskResult{}, nil
+}
+
+// retryProcessor records the retries
+type retryProcessor struct {
+	dummyProcessor
+	retries map[string][]int
+}
+
+func (r *retryProcessor) TaskInstanceRetry(ctx context.Context, logger gornir.Logger, host *gornir.Host, task gornir.Task, attempt int, err error) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.retries[host.Hostname] = append(r.retries[host.Hostname], attempt)
+	return nil
+}
+
+func TestRetryPolicy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		policy   *gornir.RetryPolicy
+		task     *flakyTask
+		err      error
+		attempts int
+		retries  map[string][]int
+	}{
+		{
+			name:     "no policy",
+			task:     &flakyTask{failures: 1},
+			err:      errFlaky,
+			attempts: 1,
+			retries:  map[string][]int{},
+		},
+		{
+			name:     "succeeds after retrying",
+			policy:   &gornir.RetryPolicy{Attempts: 3, Backoff: time.Millisecond, Jitter: 0.5},
+			task:     &flakyTask{failures: 2},
+			attempts: 3,
+			retries:  map[string][]int{"host1": {1, 2}, "host2": {1, 2}},
+		},
+		{
+			name:     "runs out of attempts",
+			policy:   &gornir.RetryPolicy{Attempts: 2, Backoff: time.Millisecond},
+			task:     &flakyTask{failures: 5},
+			err:      errFlaky,
+			attempts: 2,
+			retries:  map[string][]int{"host1": {1}, "host2": {1}},
+		},
+		{
+			name:     "error not retryable",
+			policy:   &gornir.RetryPolicy{Attempts: 3, Retryable: func(err error) bool { return err != errFlaky }},
+			task:     &flakyTask{failures: 1},
+			err:      errFlaky,
+			attempts: 1,
+			retries:  map[string][]int{},
+		},
+		{
+			name:   "task overrides policy",
+			policy: &gornir.RetryPolicy{Attempts: 1},
+			task: &flakyTask{
+				failures: 1,
+				meta:     &gornir.TaskMetadata{RetryPolicy: &gornir.RetryPolicy{Attempts: 2}},
+			},
+			attempts: 2,
+			retries:  map[string][]int{"host1": {1}, "host2": {1}},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			inv := gornir.Inventory{
+				Hosts: map[string]*gornir.Host{
+					"host1": {Hostname: "host1"},
+					"host2": {Hostname: "host2"},
+				},
+			}
+			gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Parallel())
+			if tc.policy != nil {
+				gr = gr.WithRetryPolicy(*tc.policy)
+			}
+			p := &retryProcessor{
+				dummyProcessor: *dummy(make(map[string]interface{})),
+				retries:        make(map[string][]int),
+			}
+
+			results, err := gr.WithProcessor(p).RunSync(context.Background(), tc.task)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for res := range results {
+				if res.Err() != tc.err {
+					t.Errorf("%s: got error %v, want %v", res.Host().Hostname, res.Err(), tc.err)
+				}
+				if res.Attempts() != tc.attempts {
+					t.Errorf("%s: got %d attempts, want %d", res.Host().Hostname, res.Attempts(), tc.attempts)
+				}
+			}
+			if !cmp.Equal(p.retries, tc.retries) {
+				t.Error(cmp.Diff(p.retries, tc.retries))
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@ package gornir
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -22,7 +24,19 @@ type Task interface {
 
 // TaskMetada includes some metadata about a given task
 type TaskMetadata struct {
-	Identifier string // Identifier of the task
+	Identifier  string        // Identifier of the task
+	RetryPolicy *RetryPolicy  // RetryPolicy for the task, overrides the one set in Gornir
+	Timeout     time.Duration // Timeout for each attempt of a TaskInstance, overrides the one set in Gornir
+}
+
+// TimeoutError is the error set when a TaskInstance doesn't complete within its timeout
+type TimeoutError struct {
+	Timeout time.Duration // Timeout that was exceeded
+}
+
+// Error implements the error interface
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("task instance didn't complete within %s", e.Timeout)
 }
 
 // Runner is the interface of a struct that can implement a strategy
@@ -35,10 +49,17 @@ type Runner interface {
 
 // JobResult is the result of running a task over a host.
 type JobResult struct {
-	ctx  context.Context
-	err  error
-	host *Host
-	data TaskInstanceResult
+	ctx        context.Context
+	err        error
+	host       *Host
+	data       TaskInstanceResult
+	attempts   int
+	name       string
+	duration   time.Duration
+	parent     *JobResult
+	subResults []*JobResult
+	skipped    bool       // the task wasn't executed, see Skipped
+	mux        sync.Mutex // mux guards subResults
 }
 
 // NewJobResult instantiates a new JobResult
@@ -66,6 +87,51 @@ func (r *JobResult) Host() *Host {
 	return r.host
 }
 
+// Attempts returns how many times the task was executed, 0 if it wasn't executed at all
+func (r *JobResult) Attempts() int {
+	return r.attempts
+}
+
+// Name returns the name of the task that produced the result
+func (r *JobResult) Name() string {
+	return r.name
+}
+
+// Duration returns how long it took to run the task
+func (r *JobResult) Duration() time.Duration {
+	return r.duration
+}
+
+// Parent returns the JobResult of the task that ran this one as a subtask, if any
+func (r *JobResult) Parent() *JobResult {
+	return r.parent
+}
+
+// SubResults returns the JobResults of the subtasks executed with RunSubtask
+// in the order they completed
+func (r *JobResult) SubResults() []*JobResult {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	subResults := make([]*JobResult, len(r.subResults))
+	copy(subResults, r.subResults)
+	return subResults
+}
+
+// addSubResult attaches the JobResult of a subtask
+func (r *JobResult) addSubResult(sub *JobResult) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	sub.parent = r
+	r.subResults = append(r.subResults, sub)
+}
+
+// Skipped returns true if the task wasn't executed on the host, either because the runner
+// decided so, see SkipTask, or because the context was done or the FailurePolicy exhausted
+// by the time the TaskInstance was due to start. Err returns the reason
+func (r *JobResult) Skipped() bool {
+	return r.skipped
+}
+
 // SetErr stores the error  and also propagates it to the associated Host
 func (r *JobResult) SetErr(err error) {
 	r.err = err
@@ -82,19 +148,67 @@ func (r *JobResult) SetData(data interface{}) {
 	r.data = data
 }
 
-// TaskWrapper is a helper function that runs an instance of a task on a given host
+// TaskWrapper is a helper function that runs an instance of a task on a given host.
+// If the context is already done by the time the TaskInstance is due to start
+// the task is not executed and the error of the context is used as result instead.
+// Similarly, if the FailurePolicy of the run is exhausted, the task is not executed
+// and ErrSkipped is used as result
 func TaskWrapper(ctx context.Context, logger Logger, processors Processors, wg *sync.WaitGroup, task Task, host *Host, results chan *JobResult) error {
+	defer wg.Done()
+	run := getRunState(ctx)
+	defer run.finished()
 	if err := processors.TaskInstanceStarted(ctx, logger, host, task); err != nil {
 		err = errors.Wrap(err, "problem running HostStart")
 		logger.Error(err.Error())
 		return err
 	}
 
+	jobResult := NewJobResult(ctx, host, nil, nil)
+	jobResult.name = TaskName(task)
+	ctx = withTaskInstance(ctx, processors, jobResult, task)
+	startTime := time.Now()
+	switch {
+	case run.exhausted():
+		jobResult.err, jobResult.skipped = ErrSkipped, true
+		logger.Debug("failure budget exhausted, skipping task")
+	case ctx.Err() != nil:
+		jobResult.err, jobResult.skipped = ctx.Err(), true
+		logger.Debug("context is done, skipping task")
+	default:
+		if err := runWithRetries(ctx, logger, processors, run, task, jobResult); err != nil {
+			return err
+		}
+	}
+	jobResult.duration = time.Since(startTime)
+	run.record(jobResult.err)
+	host.SetErr(jobResult.err)
+
+	if err := processors.TaskInstanceCompleted(ctx, logger, jobResult, host, task); err != nil {
+		err = errors.Wrap(err, "problem running HostCompleted")
+		logger.Error(err.Error())
+		return err
+	}
+
+	results <- jobResult
+	return nil
+}
+
+// SkipTask is a helper function for runners that decide not to execute a task on a given
+// host. The TaskInstance goes through the processors as usual but, instead of running the
+// task, err is used as result. Skipped TaskInstances don't count against the FailurePolicy
+func SkipTask(ctx context.Context, logger Logger, processors Processors, wg *sync.WaitGroup, task Task, host *Host, results chan *JobResult, err error) error {
 	defer wg.Done()
-	res, err := task.Run(ctx, logger, host)
-	host.SetErr(err)
+	defer getRunState(ctx).finished()
+	if err := processors.TaskInstanceStarted(ctx, logger, host, task); err != nil {
+		err = errors.Wrap(err, "problem running HostStart")
+		logger.Error(err.Error())
+		return err
+	}
 
-	jobResult := NewJobResult(ctx, host, res, err)
+	jobResult := NewJobResult(ctx, host, nil, err)
+	jobResult.name = TaskName(task)
+	jobResult.skipped = true
+	host.SetErr(err)
 
 	if err := processors.TaskInstanceCompleted(ctx, logger, jobResult, host, task); err != nil {
 		err = errors.Wrap(err, "problem running HostCompleted")
@@ -105,3 +219,121 @@ func TaskWrapper(ctx context.Context, logger Logger, processors Processors, wg *
 	results <- jobResult
 	return nil
 }
+
+// runWithRetries runs the task as many times as the RetryPolicy allows until it succeeds.
+// The result of the last attempt and the number of attempts are stored in the JobResult.
+// The error returned is the one returned by the processors, if any
+func runWithRetries(ctx context.Context, logger Logger, processors Processors, run *runState, task Task, jobResult *JobResult) error {
+	policy := run.retryPolicyFor(task)
+	timeout := run.timeoutFor(task)
+	for {
+		jobResult.attempts++
+		jobResult.mux.Lock()
+		jobResult.subResults = nil
+		jobResult.mux.Unlock()
+		jobResult.data, jobResult.err = runWithTimeout(ctx, logger, timeout, task, jobResult.host)
+		if !policy.retryable(jobResult.attempts, jobResult.err) {
+			return nil
+		}
+
+		backoff := policy.backoff(jobResult.attempts)
+		logger.Warn(fmt.Sprintf("attempt %d failed, retrying in %s: %s", jobResult.attempts, backoff, jobResult.err))
+		if err := processors.TaskInstanceRetry(ctx, logger, jobResult.host, task, jobResult.attempts, jobResult.err); err != nil {
+			err = errors.Wrap(err, "problem running TaskInstanceRetry")
+			logger.Error(err.Error())
+			return err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		}
+	}
+}
+
+// attemptConnections keeps track of the connections opened by an attempt of a TaskInstance
+// so they can be closed if the attempt is abandoned without touching the ones opened by
+// other attempts or TaskInstances
+type attemptConnections struct {
+	mux       sync.Mutex
+	conns     map[string]Connection
+	abandoned bool
+}
+
+type attemptConnectionsKey struct{}
+
+// getAttemptConnections returns the connections of the attempt running with ctx, if any
+func getAttemptConnections(ctx context.Context) *attemptConnections {
+	a, _ := ctx.Value(attemptConnectionsKey{}).(*attemptConnections)
+	return a
+}
+
+// add records a connection opened by the attempt. It returns false if the attempt
+// was already abandoned, in which case the connection must not be used
+func (a *attemptConnections) add(name string, conn Connection) bool {
+	if a == nil {
+		return true
+	}
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if a.abandoned {
+		return false
+	}
+	a.conns[name] = conn
+	return true
+}
+
+// abandon marks the attempt as abandoned returning the connections it opened
+func (a *attemptConnections) abandon() map[string]Connection {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.abandoned = true
+	return a.conns
+}
+
+// runWithTimeout runs an attempt of the task making sure it doesn't take longer than the timeout.
+// If the timeout is exceeded, the attempt is abandoned, the connections it opened are closed,
+// it can't open new ones, and a TimeoutError is returned. A timeout of 0 means no timeout.
+// Note the abandoned attempt might keep running, and using the connections it found already
+// opened, until it notices the context is done, even while the next attempt runs
+func runWithTimeout(ctx context.Context, logger Logger, timeout time.Duration, task Task, host *Host) (TaskInstanceResult, error) {
+	if timeout <= 0 {
+		return task.Run(ctx, logger, host)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	attempt := &attemptConnections{conns: make(map[string]Connection)}
+	tctx = context.WithValue(tctx, attemptConnectionsKey{}, attempt)
+
+	type result struct {
+		data TaskInstanceResult
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := task.Run(tctx, logger, host)
+		done <- result{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil && tctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			return r.data, &TimeoutError{Timeout: timeout}
+		}
+		return r.data, r.err
+	case <-tctx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	logger.Warn(fmt.Sprintf("task didn't complete within %s, closing the connections it opened", timeout))
+	for name, conn := range attempt.abandon() {
+		host.discardConnection(context.Background(), name, conn)
+	}
+	return nil, &TimeoutError{Timeout: timeout}
+}
@@ -0,0 +1,77 @@
+package gornir
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// taskInstance holds information about the TaskInstance being executed
+// so subtasks can find their parent and the processors to notify
+type taskInstance struct {
+	processors Processors
+	result     *JobResult
+	task       Task
+}
+
+type taskInstanceKey struct{}
+
+// withTaskInstance returns a copy of the context with information about the TaskInstance attached
+func withTaskInstance(ctx context.Context, processors Processors, result *JobResult, task Task) context.Context {
+	return context.WithValue(ctx, taskInstanceKey{}, &taskInstance{processors: processors, result: result, task: task})
+}
+
+// getTaskInstance returns the information about the TaskInstance being executed, if any
+func getTaskInstance(ctx context.Context) *taskInstance {
+	ti, _ := ctx.Value(taskInstanceKey{}).(*taskInstance)
+	return ti
+}
+
+// TaskName returns the Identifier in the metadata of the task or,
+// if it's not set, the name of the task's type
+func TaskName(task Task) string {
+	if meta := task.Metadata(); meta != nil && meta.Identifier != "" {
+		return meta.Identifier
+	}
+	return getTaskName(task)
+}
+
+// RunSubtask runs a task from within the Run method of another task. The result, error,
+// duration and name of the subtask are recorded as a child of the JobResult of the
+// parent task, which can be retrieved with JobResult.SubResults. Processors implementing
+// SubtaskProcessor are notified when the subtask starts and completes.
+// Subtasks can run subtasks of their own, building a tree of results.
+func RunSubtask(ctx context.Context, logger Logger, host *Host, task Task) (TaskInstanceResult, error) {
+	parent := getTaskInstance(ctx)
+	processors := Processors{}
+	if parent != nil {
+		processors = parent.processors
+	}
+	logger = logger.WithField("subtask", TaskName(task))
+
+	if err := processors.SubtaskStarted(ctx, logger, host, task); err != nil {
+		err = errors.Wrap(err, "problem running SubtaskStarted")
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	jobResult := NewJobResult(ctx, host, nil, nil)
+	jobResult.name = TaskName(task)
+	jobResult.attempts = 1
+
+	startTime := time.Now()
+	jobResult.data, jobResult.err = task.Run(withTaskInstance(ctx, processors, jobResult, task), logger, host)
+	jobResult.duration = time.Since(startTime)
+
+	if parent != nil {
+		parent.result.addSubResult(jobResult)
+	}
+
+	if err := processors.SubtaskCompleted(ctx, logger, jobResult, host, task); err != nil {
+		err = errors.Wrap(err, "problem running SubtaskCompleted")
+		logger.Error(err.Error())
+		return jobResult.data, err
+	}
+	return jobResult.data, jobResult.err
+}
@@ -0,0 +1,140 @@
+package gornir_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/logger"
+	"github.com/nornir-automation/gornir/pkg/plugins/runner"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var errSubtask = errors.New("subtask failed")
+
+// namedTask returns its name as result and fails if told so
+type namedTask struct {
+	name string
+	fail bool
+	subs []gornir.Task
+}
+
+func (t *namedTask) Metadata() *gornir.TaskMetadata {
+	return &gornir.TaskMetadata{Identifier: t.name}
+}
+
+func (t *namedTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	for _, sub := range t.subs {
+		if _, err := gornir.RunSubtask(ctx, logger, host, sub); err != nil {
+			return nil, err
+		}
+	}
+	if t.fail {
+		return nil, errSubtask
+	}
+	return t.name, nil
+}
+
+// subtaskProcessor records the subtask events
+type subtaskProcessor struct {
+	dummyProcessor
+	events []string
+}
+
+func (r *subtaskProcessor) SubtaskStarted(ctx context.Context, logger gornir.Logger, host *gornir.Host, task gornir.Task) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.events = append(r.events, "started "+gornir.TaskName(task))
+	return nil
+}
+
+func (r *subtaskProcessor) SubtaskCompleted(ctx context.Context, logger gornir.Logger, jobResult *gornir.JobResult, host *gornir.Host, task gornir.Task) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.events = append(r.events, "completed "+jobResult.Name()+" (parent "+jobResult.Parent().Name()+")")
+	return nil
+}
+
+type resultNode struct {
+	Name     string
+	Data     interface{}
+	Err      error
+	Children []resultNode
+}
+
+func toTree(r *gornir.JobResult) resultNode {
+	n := resultNode{Name: r.Name(), Data: r.Data(), Err: r.Err()}
+	for _, sub := range r.SubResults() {
+		n.Children = append(n.Children, toTree(sub))
+	}
+	return n
+}
+
+func TestRunSubtask(t *testing.T) {
+	task := &namedTask{
+		name: "parent",
+		subs: []gornir.Task{
+			&namedTask{name: "child1"},
+			&namedTask{
+				name: "child2",
+				subs: []gornir.Task{
+					&namedTask{name: "grandchild1"},
+					&namedTask{name: "grandchild2", fail: true},
+				},
+			},
+			&namedTask{name: "child3"},
+		},
+	}
+	inv := gornir.Inventory{
+		Hosts: map[string]*gornir.Host{
+			"host1": {Hostname: "host1"},
+		},
+	}
+	p := &subtaskProcessor{dummyProcessor: *dummy(make(map[string]interface{}))}
+	gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Sorted()).WithProcessor(p)
+
+	results, err := gr.RunSync(context.Background(), task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := <-results
+
+	expected := resultNode{
+		Name: "parent",
+		Err:  errSubtask,
+		Children: []resultNode{
+			{Name: "child1", Data: "child1"},
+			{
+				Name: "child2",
+				Err:  errSubtask,
+				Children: []resultNode{
+					{Name: "grandchild1", Data: "grandchild1"},
+					{Name: "grandchild2", Err: errSubtask},
+				},
+			},
+		},
+	}
+	got := toTree(res)
+	if !cmp.Equal(got, expected, cmp.Comparer(func(x, y error) bool { return x == y })) {
+		t.Errorf("got %+v, want %+v", got, expected)
+	}
+	if res.Duration() <= 0 || res.SubResults()[0].Duration() <= 0 {
+		t.Error("durations were not recorded")
+	}
+
+	expectedEvents := []string{
+		"started child1",
+		"completed child1 (parent parent)",
+		"started child2",
+		"started grandchild1",
+		"completed grandchild1 (parent child2)",
+		"started grandchild2",
+		"completed grandchild2 (parent child2)",
+		"completed child2 (parent parent)",
+	}
+	if !cmp.Equal(p.events, expectedEvents) {
+		t.Error(cmp.Diff(p.events, expectedEvents))
+	}
+}
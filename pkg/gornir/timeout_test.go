@@ -0,0 +1,226 @@
+package gornir_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/logger"
+	"github.com/nornir-automation/gornir/pkg/plugins/runner"
+)
+
+type fakeConnection struct {
+	mux    sync.Mutex
+	closed bool
+	dead   bool
+}
+
+func (c *fakeConnection) Close(ctx context.Context) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConnection) IsAlive(ctx context.Context) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return !c.dead && !c.closed
+}
+
+func (c *fakeConnection) kill() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.dead = true
+}
+
+func (c *fakeConnection) isClosed() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.closed
+}
+
+// hungTask opens a connection and then blocks ignoring the context
+// until release is closed
+type hungTask struct {
+	meta    *gornir.TaskMetadata
+	release chan struct{}
+	conns   map[string]*fakeConnection
+}
+
+func (t *hungTask) Metadata() *gornir.TaskMetadata {
+	return t.meta
+}
+
+func (t *hungTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	if err := host.SetConnectionContext(ctx, "fake", t.conns[host.Hostname]); err != nil {
+		return nil, err
+	}
+	<-t.release
+	return dummyTaskResult{}, nil
+}
+
+func TestTimeout(t *testing.T) {
+	testCases := []struct {
+		name    string
+		timeout time.Duration
+		meta    *gornir.TaskMetadata
+		want    time.Duration
+	}{
+		{
+			name:    "timeout set in gornir",
+			timeout: 50 * time.Millisecond,
+			want:    50 * time.Millisecond,
+		},
+		{
+			name:    "timeout set in the task",
+			timeout: time.Hour,
+			meta:    &gornir.TaskMetadata{Timeout: 20 * time.Millisecond},
+			want:    20 * time.Millisecond,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			inv := gornir.Inventory{
+				Hosts: map[string]*gornir.Host{
+					"host1": {Hostname: "host1"},
+					"host2": {Hostname: "host2"},
+				},
+			}
+			task := &hungTask{
+				meta:    tc.meta,
+				release: make(chan struct{}),
+				conns: map[string]*fakeConnection{
+					"host1": {},
+					"host2": {},
+				},
+			}
+			defer close(task.release)
+
+			gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Parallel())
+
+			startTime := time.Now()
+			results, err := gr.WithTimeout(tc.timeout).RunSync(context.Background(), task)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(startTime); elapsed > tc.want+500*time.Millisecond {
+				t.Errorf("RunSync took %v, timeout doesn't seem to work", elapsed)
+			}
+
+			for res := range results {
+				terr, ok := res.Err().(*gornir.TimeoutError)
+				if !ok {
+					t.Errorf("%s: expected a TimeoutError, got %v", res.Host().Hostname, res.Err())
+					continue
+				}
+				if terr.Timeout != tc.want {
+					t.Errorf("%s: got timeout %v, want %v", res.Host().Hostname, terr.Timeout, tc.want)
+				}
+				if !task.conns[res.Host().Hostname].isClosed() {
+					t.Errorf("%s: connection opened by the task wasn't closed", res.Host().Hostname)
+				}
+				if _, err := res.Host().GetConnection("fake"); err == nil {
+					t.Errorf("%s: connection opened by the task is still stored in the host", res.Host().Hostname)
+				}
+			}
+		})
+	}
+}
+
+func TestTimeoutNotExceeded(t *testing.T) {
+	inv := gornir.Inventory{
+		Hosts: map[string]*gornir.Host{
+			"host1": {Hostname: "host1"},
+		},
+	}
+	gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Sorted())
+
+	results, err := gr.WithTimeout(time.Second).RunSync(context.Background(), &dummyTask{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := <-results
+	if r.Err() != nil {
+		t.Errorf("unexpected error: %v", r.Err())
+	}
+}
+
+// retriedTask opens a connection on each attempt, the first one blocks ignoring the context
+type retriedTask struct {
+	meta     *gornir.TaskMetadata
+	mux      sync.Mutex
+	attempts int
+	conns    []*fakeConnection
+	late     *fakeConnection
+	lateErr  error
+	closed   chan bool // whether the connection of the second attempt was closed while in use
+}
+
+func (t *retriedTask) Metadata() *gornir.TaskMetadata {
+	return t.meta
+}
+
+func (t *retriedTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	t.mux.Lock()
+	t.attempts++
+	attempt := t.attempts
+	conn := &fakeConnection{}
+	t.conns = append(t.conns, conn)
+	t.mux.Unlock()
+
+	if attempt == 1 {
+		if err := host.SetConnectionContext(ctx, "fake", conn); err != nil {
+			return nil, err
+		}
+		time.Sleep(300 * time.Millisecond)
+		// too late, the attempt was abandoned
+		t.mux.Lock()
+		defer t.mux.Unlock()
+		t.lateErr = host.SetConnectionContext(ctx, "fake", t.late)
+		return nil, t.lateErr
+	}
+	if err := host.SetConnectionContext(ctx, "fake", conn); err != nil {
+		return nil, err
+	}
+	// outlive the first attempt
+	time.Sleep(150 * time.Millisecond)
+	t.closed <- conn.isClosed()
+	return dummyTaskResult{}, nil
+}
+
+func TestTimeoutRetry(t *testing.T) {
+	inv := gornir.Inventory{Hosts: map[string]*gornir.Host{"host1": {Hostname: "host1"}}}
+	task := &retriedTask{
+		meta:   &gornir.TaskMetadata{Timeout: 200 * time.Millisecond, RetryPolicy: &gornir.RetryPolicy{Attempts: 2}},
+		late:   &fakeConnection{},
+		closed: make(chan bool, 1),
+	}
+	gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Sorted())
+
+	results, err := gr.RunSync(context.Background(), task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := <-results; r.Err() != nil {
+		t.Fatalf("unexpected error: %v", r.Err())
+	}
+	if <-task.closed {
+		t.Error("connection of the second attempt was closed while in use")
+	}
+	if !task.conns[0].isClosed() {
+		t.Error("connection of the abandoned attempt wasn't closed")
+	}
+	conn, err := inv.Hosts["host1"].GetConnection("fake")
+	if err != nil || conn != task.conns[1] {
+		t.Errorf("got %v, %v, want the connection of the second attempt", conn, err)
+	}
+	task.mux.Lock()
+	defer task.mux.Unlock()
+	if task.lateErr == nil || !task.late.isClosed() {
+		t.Errorf("connection opened after the attempt was abandoned was stored: %v", task.lateErr)
+	}
+}
@@ -0,0 +1,245 @@
+package connection
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Authentication methods supported by SSHOpen
+const (
+	AuthPublicKey           = "publickey"            // Private keys set in Auth or in the host
+	AuthAgent               = "agent"                // Keys held by the SSH agent listening on SSH_AUTH_SOCK
+	AuthPassword            = "password"             // Password of the host
+	AuthKeyboardInteractive = "keyboard-interactive" // Answers the prompts of the device with the password of the host
+)
+
+// Keys in the Extras of the "ssh" gornir.ConnectionOptions used to configure the
+// authentication of each host. They override the values set in Auth
+const (
+	AuthMethodsKey          = "auth_methods"           // List of methods to try, in order
+	PrivateKeyFilesKey      = "private_key_files"      // Path, or list of paths, of private keys
+	PrivateKeyKey           = "private_key"            // Private key in PEM format
+	PrivateKeyPassphraseKey = "private_key_passphrase" // Passphrase to decrypt the private keys
+)
+
+// DefaultAuthMethods are the authentication methods tried if none is set, preceded by
+// publickey if there are private keys configured. The agent is only used if it's set
+// explicitly as it may hold more keys than the servers allow to try, see MaxAuthTries
+// in sshd_config. Methods that can't be used, i.e. agent when SSH_AUTH_SOCK is not
+// set or can't be reached, are skipped
+var DefaultAuthMethods = []string{AuthPassword}
+
+// Auth configures how SSHOpen authenticates against the hosts. Each host can override
+// these settings in the Extras of its "ssh" ConnectionOptions, i.e.:
+//
+//	connection_options:
+//	    ssh:
+//	        extras:
+//	            auth_methods: [agent, keyboard-interactive]
+//	            private_key_files: [/home/user/.ssh/id_ed25519]
+//	            private_key_passphrase: secret
+type Auth struct {
+	Methods              []string                         // Methods to try in order, see DefaultAuthMethods for the default
+	PrivateKeyFiles      []string                         // Paths of the private keys to use with publickey
+	PrivateKeyPassphrase string                           // Passphrase to decrypt the private keys, if needed
+	KeyboardInteractive  ssh.KeyboardInteractiveChallenge // Overrides how keyboard-interactive prompts are answered
+}
+
+// stringList converts a value found in the host data into a list of strings
+func stringList(key string, v interface{}) ([]string, error) {
+	switch l := v.(type) {
+	case string:
+		return []string{l}, nil
+	case []string:
+		return l, nil
+	case []interface{}:
+		// this is what we get when the data comes from a yaml file
+		res := make([]string, len(l))
+		for i, e := range l {
+			s, ok := e.(string)
+			if !ok {
+				return nil, errors.Errorf("%s must be a string or a list of strings, found %v", key, e)
+			}
+			res[i] = s
+		}
+		return res, nil
+	default:
+		return nil, errors.Errorf("%s must be a string or a list of strings, found %v", key, v)
+	}
+}
+
+// forHost returns a copy of the Auth with the overrides set by the host
+func (a Auth) forHost(opts gornir.ConnectionOptions) (Auth, []byte, error) {
+	var err error
+	if v, ok := opts.Extras[AuthMethodsKey]; ok {
+		if a.Methods, err = stringList(AuthMethodsKey, v); err != nil {
+			return a, nil, err
+		}
+	}
+	if v, ok := opts.Extras[PrivateKeyFilesKey]; ok {
+		if a.PrivateKeyFiles, err = stringList(PrivateKeyFilesKey, v); err != nil {
+			return a, nil, err
+		}
+	}
+	if v, ok := opts.Extras[PrivateKeyPassphraseKey]; ok {
+		if a.PrivateKeyPassphrase, ok = v.(string); !ok {
+			return a, nil, errors.Errorf("%s must be a string, found %v", PrivateKeyPassphraseKey, v)
+		}
+	}
+	var privateKey []byte
+	if v, ok := opts.Extras[PrivateKeyKey]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return a, nil, errors.Errorf("%s must be a string, found %v", PrivateKeyKey, v)
+		}
+		privateKey = []byte(s)
+	}
+	if len(a.Methods) == 0 {
+		a.Methods = DefaultAuthMethods
+		if len(a.PrivateKeyFiles) > 0 || len(privateKey) > 0 {
+			a.Methods = append([]string{AuthPublicKey}, DefaultAuthMethods...)
+		}
+	}
+	return a, privateKey, nil
+}
+
+// parsePrivateKey parses a private key decrypting it if needed
+func parsePrivateKey(name string, key []byte, passphrase string) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(key)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		if passphrase == "" {
+			return nil, errors.Errorf("private key %s is encrypted and no passphrase was provided", name)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	}
+	return signer, errors.Wrapf(err, "problem parsing private key %s", name)
+}
+
+// signers returns the signers of the private keys
+func (a Auth) signers(privateKey []byte) ([]ssh.Signer, error) {
+	signers := []ssh.Signer{}
+	if len(privateKey) > 0 {
+		signer, err := parsePrivateKey("from host data", privateKey, a.PrivateKeyPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+	for _, path := range a.PrivateKeyFiles {
+		key, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "problem reading private key")
+		}
+		signer, err := parsePrivateKey(path, key, a.PrivateKeyPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+// passwordChallenge answers the keyboard-interactive prompts that don't echo
+// the answer, which is how devices ask for passwords, with the password
+func passwordChallenge(password string) ssh.KeyboardInteractiveChallenge {
+	return func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i := range questions {
+			if !echos[i] {
+				answers[i] = password
+			}
+		}
+		return answers, nil
+	}
+}
+
+// authMethods builds the list of ssh.AuthMethod for the host. Keys from files, from the host data
+// and from the agent are all offered within a single publickey method as the ssh package doesn't
+// try the same method twice. The returned function needs to be called once the authentication
+// is done to release the connection to the agent
+func (a Auth) authMethods(opts gornir.ConnectionOptions, logger gornir.Logger) ([]ssh.AuthMethod, func(), error) {
+	a, privateKey, err := a.forHost(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var agentConn net.Conn
+	release := func() {
+		if agentConn != nil {
+			agentConn.Close() // nolint
+		}
+	}
+
+	var signers []ssh.Signer
+	methods := []ssh.AuthMethod{}
+	addSigners := func(s []ssh.Signer) {
+		if signers == nil {
+			methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				return signers, nil
+			}))
+		}
+		signers = append(signers, s...)
+	}
+	for _, method := range a.Methods {
+		switch method {
+		case AuthPublicKey:
+			s, err := a.signers(privateKey)
+			if err != nil {
+				release()
+				return nil, nil, err
+			}
+			if len(s) == 0 {
+				logger.Debug("no private keys configured, skipping publickey authentication")
+				continue
+			}
+			addSigners(s)
+		case AuthAgent:
+			if agentConn != nil {
+				continue
+			}
+			socket := os.Getenv("SSH_AUTH_SOCK")
+			if socket == "" {
+				logger.Debug("SSH_AUTH_SOCK is not set, skipping agent authentication")
+				continue
+			}
+			agentConn, err = net.Dial("unix", socket)
+			if err != nil {
+				logger.Warn(errors.Wrap(err, "problem connecting to the SSH agent, skipping agent authentication").Error())
+				continue
+			}
+			s, err := agent.NewClient(agentConn).Signers()
+			if err != nil {
+				logger.Warn(errors.Wrap(err, "problem retrieving keys from the SSH agent, skipping agent authentication").Error())
+				continue
+			}
+			if len(s) == 0 {
+				logger.Debug("the SSH agent has no keys, skipping agent authentication")
+				continue
+			}
+			addSigners(s)
+		case AuthPassword:
+			methods = append(methods, ssh.Password(opts.Password))
+		case AuthKeyboardInteractive:
+			challenge := a.KeyboardInteractive
+			if challenge == nil {
+				challenge = passwordChallenge(opts.Password)
+			}
+			methods = append(methods, ssh.KeyboardInteractive(challenge))
+		default:
+			release()
+			return nil, nil, errors.Errorf("unknown authentication method '%s'", method)
+		}
+	}
+	if len(methods) == 0 {
+		release()
+		return nil, nil, errors.Errorf("none of the authentication methods %v can be used", a.Methods)
+	}
+	return methods, release, nil
+}
@@ -0,0 +1,209 @@
+package connection
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestAuth(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	dir, err := ioutil.TempDir("", "gornir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plain, err := ssh.MarshalPrivateKey(server.userKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := ssh.MarshalPrivateKeyWithPassphrase(server.userKey, "", []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unauthorized, err := ssh.MarshalPrivateKey(newPrivateKey(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainFile := filepath.Join(dir, "id_ecdsa")
+	if err := ioutil.WriteFile(plainFile, pem.EncodeToMemory(plain), 0600); err != nil {
+		t.Fatal(err)
+	}
+	encryptedFile := filepath.Join(dir, "id_ecdsa_encrypted")
+	if err := ioutil.WriteFile(encryptedFile, pem.EncodeToMemory(encrypted), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		auth     *Auth
+		password string
+		extras   map[string]interface{}
+		method   string
+		err      string
+	}{
+		{
+			name:     "password by default",
+			password: "secret",
+			method:   AuthPassword,
+		},
+		{
+			name:     "private key file",
+			auth:     &Auth{PrivateKeyFiles: []string{plainFile}},
+			password: "wrong",
+			method:   AuthPublicKey,
+		},
+		{
+			name:     "encrypted private key file",
+			auth:     &Auth{PrivateKeyFiles: []string{encryptedFile}, PrivateKeyPassphrase: "passphrase"},
+			password: "wrong",
+			method:   AuthPublicKey,
+		},
+		{
+			name: "encrypted private key without passphrase",
+			auth: &Auth{PrivateKeyFiles: []string{encryptedFile}},
+			err:  "is encrypted and no passphrase was provided",
+		},
+		{
+			name:     "private key from the host overrides the defaults",
+			auth:     &Auth{PrivateKeyFiles: []string{filepath.Join(dir, "missing")}},
+			password: "wrong",
+			extras: map[string]interface{}{
+				PrivateKeyKey:           string(pem.EncodeToMemory(encrypted)),
+				PrivateKeyFilesKey:      []interface{}{},
+				PrivateKeyPassphraseKey: "passphrase",
+			},
+			method: AuthPublicKey,
+		},
+		{
+			name:     "keyboard-interactive",
+			password: "secret",
+			extras:   map[string]interface{}{AuthMethodsKey: []interface{}{AuthKeyboardInteractive, AuthPassword}},
+			method:   AuthKeyboardInteractive,
+		},
+		{
+			name:     "fallback to the next method",
+			auth:     &Auth{Methods: []string{AuthPublicKey, AuthKeyboardInteractive}},
+			password: "secret",
+			extras:   map[string]interface{}{PrivateKeyKey: string(pem.EncodeToMemory(unauthorized))},
+			method:   AuthKeyboardInteractive,
+		},
+		{
+			name:   "unknown method",
+			extras: map[string]interface{}{AuthMethodsKey: "kerberos"},
+			err:    "unknown authentication method 'kerberos'",
+		},
+		{
+			name:   "no usable method",
+			auth:   &Auth{Methods: []string{AuthPublicKey}},
+			extras: map[string]interface{}{},
+			err:    "none of the authentication methods [publickey] can be used",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			host := server.host()
+			host.Password = tc.password
+			host.Data = nil
+			host.ConnectionOptions = map[string]gornir.ConnectionOptions{
+				"ssh": {Extras: tc.extras},
+			}
+			conn, err := (&SSHOpen{Auth: tc.auth}).Open(context.Background(), host)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("got error %v, want one containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Close(context.Background()) // nolint
+			if server.authMethod() != tc.method {
+				t.Errorf("authenticated with %s, want %s", server.authMethod(), tc.method)
+			}
+		})
+	}
+}
+
+func TestAuthAgent(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	dir, err := ioutil.TempDir("", "gornir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: server.userKey}); err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn) // nolint
+		}
+	}()
+
+	previous, wasSet := os.LookupEnv("SSH_AUTH_SOCK")
+	if err := os.Setenv("SSH_AUTH_SOCK", socket); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if wasSet {
+			os.Setenv("SSH_AUTH_SOCK", previous) // nolint
+		} else {
+			os.Unsetenv("SSH_AUTH_SOCK") // nolint
+		}
+	}()
+
+	host := server.host()
+	host.Password = "wrong"
+	conn, err := (&SSHOpen{Auth: &Auth{Methods: []string{AuthAgent, AuthPassword}}}).Open(context.Background(), host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close(context.Background()) // nolint
+	if server.authMethod() != AuthPublicKey {
+		t.Errorf("authenticated with %s, want %s", server.authMethod(), AuthPublicKey)
+	}
+
+	// an agent that can't be reached is skipped
+	if err := os.Setenv("SSH_AUTH_SOCK", filepath.Join(dir, "missing.sock")); err != nil {
+		t.Fatal(err)
+	}
+	host.Password = "secret"
+	conn, err = (&SSHOpen{Auth: &Auth{Methods: []string{AuthAgent, AuthPassword}}}).Open(context.Background(), host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close(context.Background()) // nolint
+	if server.authMethod() != AuthPassword {
+		t.Errorf("authenticated with %s, want %s", server.authMethod(), AuthPassword)
+	}
+}
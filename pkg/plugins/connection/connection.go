@@ -1,2 +1,14 @@
-// Package connection implements various Connection plugins that can be run over Hosts
+// Package connection implements various Connection plugins that can be run over Hosts.
+//
+// Importing this package registers the following connections so they are opened
+// lazily by gornir.Host.GetConnection:
+//   - "ssh": opened with SSHOpen's default settings
 package connection
+
+import (
+	"github.com/nornir-automation/gornir/pkg/gornir"
+)
+
+func init() {
+	gornir.RegisterConnection("ssh", (&SSHOpen{}).Open)
+}
@@ -0,0 +1,119 @@
+package connection
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// withContext runs f, which is expected to do some I/O over closer, making sure it
+// returns when the context is done by closing closer. If the context is done before
+// f completes, the error of the context is returned wrapped, so callers can tell
+// it apart with errors.Cause, and closer is left closed
+func withContext(ctx context.Context, closer io.Closer, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "context done")
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			closer.Close() // nolint
+		case <-done:
+		}
+	}()
+	err := f()
+	close(done)
+	<-exited
+	if ctx.Err() != nil {
+		return errors.Wrap(ctx.Err(), "context done")
+	}
+	return err
+}
+
+// dialSSH establishes an SSH connection to addr using d. Both, establishing the
+// connection and the SSH handshake, are aborted if the context is done
+func dialSSH(ctx context.Context, d dialer, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.Wrap(ctx.Err(), "context done")
+		}
+		return nil, err
+	}
+	var client *ssh.Client
+	err = withContext(ctx, conn, func() error {
+		c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+		if err != nil {
+			return err
+		}
+		client = ssh.NewClient(c, chans, reqs)
+		return nil
+	})
+	if err != nil {
+		conn.Close() // nolint
+		return nil, err
+	}
+	return client, nil
+}
+
+// dialer is implemented by anything that can establish connections,
+// i.e. net.Dialer, ssh.Client or socks5Dialer
+type dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// NewSession opens a new session on the connection. Unlike ssh.Client.NewSession,
+// it returns as soon as the context is done with its error wrapped
+func (s *SSH) NewSession(ctx context.Context) (*ssh.Session, error) {
+	type result struct {
+		session *ssh.Session
+		err     error
+	}
+	res := make(chan result, 1)
+	go func() {
+		session, err := s.Client.NewSession()
+		res <- result{session, err}
+	}()
+	select {
+	case r := <-res:
+		return r.session, r.err
+	case <-ctx.Done():
+		// close the session once, and if, it's opened
+		go func() {
+			if r := <-res; r.err == nil {
+				r.session.Close() // nolint
+			}
+		}()
+		return nil, errors.Wrap(ctx.Err(), "context done")
+	}
+}
+
+// RunContext runs the command on the session, like ssh.Session.Run, but if the context
+// is done before the command completes, the command is sent SIGKILL, the session
+// is closed and the error of the context is returned wrapped once the output of the
+// session has been copied, so Stdout and Stderr can be read as soon as it returns
+func RunContext(ctx context.Context, session *ssh.Session, cmd string) error {
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	res := make(chan error, 1)
+	go func() {
+		res <- session.Wait()
+	}()
+	select {
+	case err := <-res:
+		return err
+	case <-ctx.Done():
+		// not all servers support signals so we close the session as well
+		session.Signal(ssh.SIGKILL) // nolint
+		session.Close()             // nolint
+		<-res
+		return errors.Wrap(ctx.Err(), "context done")
+	}
+}
@@ -0,0 +1,127 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestOpenContext(t *testing.T) {
+	// a server that accepts connections but never completes the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close() // nolint
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close() // nolint
+		}
+	}()
+	bastion := newTestServer(t)
+	defer bastion.close()
+
+	testCases := []struct {
+		name string
+		open *SSHOpen
+	}{
+		{name: "direct", open: &SSHOpen{}},
+		{name: "through a jump host", open: &SSHOpen{ProxyJump: []string{bastion.address()}, JumpAuth: &JumpHostAuth{Password: "secret"}}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			host := bastion.host()
+			addr := listener.Addr().(*net.TCPAddr)
+			host.Hostname = addr.IP.String()
+			host.Port = uint16(addr.Port)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			conn, err := tc.open.Open(ctx, host)
+			if err == nil {
+				conn.Close(context.Background()) // nolint
+				t.Fatal("expected an error")
+			}
+			if errors.Cause(err) != context.DeadlineExceeded {
+				t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("took %s to give up", elapsed)
+			}
+		})
+	}
+	waitForConnections(t, bastion, "bastion", 0)
+}
+
+func TestRunContext(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	conn, err := (&SSHOpen{}).Open(context.Background(), server.host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background()) // nolint
+	sshConn := conn.(*SSH)
+
+	testCases := []struct {
+		name       string
+		command    string
+		exitStatus int
+		err        error
+	}{
+		{name: "completes", command: "echo"},
+		{name: "fails", command: "exit 3", exitStatus: 3},
+		{name: "cancelled", command: "hang", err: context.DeadlineExceeded},
+		{name: "cancelled while writing", command: "flood", err: context.DeadlineExceeded},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			session, err := sshConn.NewSession(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer session.Close() // nolint
+			stdout := &bytes.Buffer{}
+			session.Stdout = stdout
+			err = RunContext(ctx, session, tc.command)
+			out := stdout.String() // the output is no longer written once RunContext returns
+			if tc.exitStatus != 0 {
+				if exitErr, ok := errors.Cause(err).(*ssh.ExitError); !ok || exitErr.ExitStatus() != tc.exitStatus {
+					t.Errorf("got error %v, want exit status %d", err, tc.exitStatus)
+				}
+				return
+			}
+			if errors.Cause(err) != tc.err {
+				t.Errorf("got error %v, want %v", err, tc.err)
+			}
+			if tc.err == nil && out != tc.command {
+				t.Errorf("got output %q, want %q", out, tc.command)
+			}
+		})
+	}
+
+	// the connection is still usable after cancelling a command
+	session, err := sshConn.NewSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close() // nolint
+	if out, err := session.Output("echo"); err != nil || string(out) != "echo" {
+		t.Errorf("got %q and error %v", out, err)
+	}
+}
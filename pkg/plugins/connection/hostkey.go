@@ -0,0 +1,204 @@
+package connection
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyFingerprintsKey is the key in the data of a host (see gornir.Host.GetData) that
+// pins the keys the host is allowed to present. The value can be either a fingerprint or
+// a list of them, in the SHA256 format printed by `ssh-keygen -l`, i.e.
+// "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8", or in the legacy MD5 format
+const HostKeyFingerprintsKey = "ssh_host_key_fingerprints"
+
+// knownHostsMux serializes the access to known_hosts files so concurrent
+// connections don't corrupt them when trusting keys on first use
+var knownHostsMux sync.Mutex
+
+// knownHosts is a parsed known_hosts file, it's parsed again if the file changes
+type knownHosts struct {
+	check   ssh.HostKeyCallback
+	modTime time.Time
+	size    int64
+}
+
+// knownHostsFiles caches the parsed known_hosts files by path, guarded by knownHostsMux
+var knownHostsFiles = make(map[string]*knownHosts)
+
+// HostKeyVerification configures how SSHOpen verifies the key presented by the hosts.
+// Hosts present in KnownHostsFile are only asked for keys of the types on record, like
+// OpenSSH does, so a host with keys of several types is not reported as changed
+type HostKeyVerification struct {
+	KnownHostsFile  string // OpenSSH known_hosts file to verify the keys against
+	TrustOnFirstUse bool   // Add keys of hosts not present in KnownHostsFile instead of rejecting them
+}
+
+// load returns the parsed KnownHostsFile, creating it if TrustOnFirstUse is set.
+// The file is only parsed again if it changed since the last time
+func (v *HostKeyVerification) load() (ssh.HostKeyCallback, error) {
+	if v.KnownHostsFile == "" {
+		return nil, errors.New("a known_hosts file is required to verify host keys")
+	}
+
+	knownHostsMux.Lock()
+	defer knownHostsMux.Unlock()
+	if v.TrustOnFirstUse {
+		// make sure the file exists so we can start with an empty one
+		f, err := os.OpenFile(v.KnownHostsFile, os.O_CREATE|os.O_RDONLY, 0600)
+		if err != nil {
+			return nil, errors.Wrap(err, "problem creating known_hosts file")
+		}
+		if err := f.Close(); err != nil {
+			return nil, errors.Wrap(err, "problem creating known_hosts file")
+		}
+	}
+	info, err := os.Stat(v.KnownHostsFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem reading known_hosts file")
+	}
+	if kh, ok := knownHostsFiles[v.KnownHostsFile]; ok && kh.modTime.Equal(info.ModTime()) && kh.size == info.Size() {
+		return kh.check, nil
+	}
+	check, err := knownhosts.New(v.KnownHostsFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem reading known_hosts file")
+	}
+	knownHostsFiles[v.KnownHostsFile] = &knownHosts{check: check, modTime: info.ModTime(), size: info.Size()}
+	return check, nil
+}
+
+// callback returns a ssh.HostKeyCallback that verifies the keys against the known_hosts file
+func (v *HostKeyVerification) callback() (ssh.HostKeyCallback, error) {
+	check, err := v.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		keyErr, ok := err.(*knownhosts.KeyError)
+		if !ok {
+			return err
+		}
+		if len(keyErr.Want) > 0 {
+			want := keyErr.Want[0]
+			return errors.Errorf(
+				"host key for %s has changed, key with fingerprint %s doesn't match the one in %s:%d, someone could be eavesdropping on you",
+				hostname, ssh.FingerprintSHA256(key), want.Filename, want.Line,
+			)
+		}
+		if !v.TrustOnFirstUse {
+			return errors.Errorf("host key for %s with fingerprint %s is unknown, it's not present in %s", hostname, ssh.FingerprintSHA256(key), v.KnownHostsFile)
+		}
+		return v.trust(hostname, key)
+	}, nil
+}
+
+// probeKey is a key no host has, checking it lists the keys on record for a host
+type probeKey struct{}
+
+func (probeKey) Type() string                                 { return "gornir-probe" }
+func (probeKey) Marshal() []byte                              { return []byte("gornir-probe") }
+func (probeKey) Verify(data []byte, sig *ssh.Signature) error { return errors.New("probe key") }
+
+// algorithms returns the host key algorithms matching the keys on record for addr, in the
+// format host:port, so the host presents one of them instead of a key of a different type,
+// which would be reported as a changed key. It returns nil if the host is unknown
+func (v *HostKeyVerification) algorithms(addr string) ([]string, error) {
+	check, err := v.load()
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid address %s", addr)
+	}
+	p, _ := strconv.Atoi(port) // nolint
+	remote := &net.TCPAddr{IP: net.ParseIP(host), Port: p}
+	keyErr, ok := check(addr, remote, probeKey{}).(*knownhosts.KeyError)
+	if !ok || len(keyErr.Want) == 0 {
+		return nil, nil
+	}
+	algorithms := []string{}
+	for _, want := range keyErr.Want {
+		if want.Key.Type() == ssh.KeyAlgoRSA {
+			// the same key can be used with the newer signature algorithms
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		algorithms = append(algorithms, want.Key.Type())
+	}
+	sort.Strings(algorithms)
+	return algorithms, nil
+}
+
+// trust adds the key of the host to the known_hosts file
+func (v *HostKeyVerification) trust(hostname string, key ssh.PublicKey) error {
+	knownHostsMux.Lock()
+	defer knownHostsMux.Unlock()
+	f, err := os.OpenFile(v.KnownHostsFile, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "problem opening known_hosts file")
+	}
+	if _, err := fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)); err != nil {
+		f.Close() // nolint
+		return errors.Wrap(err, "problem writing known_hosts file")
+	}
+	return errors.Wrap(f.Close(), "problem writing known_hosts file")
+}
+
+// pinnedFingerprints returns the fingerprints set in the host data under HostKeyFingerprintsKey
+func pinnedFingerprints(host *gornir.Host) ([]string, error) {
+	v, ok := host.GetData(HostKeyFingerprintsKey)
+	if !ok {
+		return nil, nil
+	}
+	return stringList(HostKeyFingerprintsKey, v)
+}
+
+// pinnedCallback returns a ssh.HostKeyCallback that only accepts keys matching the fingerprints
+func pinnedCallback(fingerprints []string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		sha256 := ssh.FingerprintSHA256(key)
+		md5 := ssh.FingerprintLegacyMD5(key)
+		for _, fp := range fingerprints {
+			if fp == sha256 || fp == md5 || fp == "MD5:"+md5 {
+				return nil
+			}
+		}
+		return errors.Errorf("host key for %s with fingerprint %s doesn't match any of the pinned fingerprints", hostname, sha256)
+	}
+}
+
+// hostKeyCallback returns the ssh.HostKeyCallback to verify the key of the host, reachable
+// at addr, and the host key algorithms to ask it for, if they are known. Fingerprints pinned
+// in the host data take precedence over the known_hosts file. If there is nothing to verify
+// against, nil is returned
+func hostKeyCallback(v *HostKeyVerification, host *gornir.Host, addr string) (ssh.HostKeyCallback, []string, error) {
+	fingerprints, err := pinnedFingerprints(host)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(fingerprints) > 0 {
+		return pinnedCallback(fingerprints), nil, nil
+	}
+	if v == nil {
+		return nil, nil, nil
+	}
+	callback, err := v.callback()
+	if err != nil {
+		return nil, nil, err
+	}
+	algorithms, err := v.algorithms(addr)
+	return callback, algorithms, err
+}
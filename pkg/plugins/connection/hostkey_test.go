@@ -0,0 +1,163 @@
+package connection
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestHostKeyVerification(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	dir, err := ioutil.TempDir("", "gornir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeKnownHosts := func(name string, key ssh.PublicKey) string {
+		path := filepath.Join(dir, name)
+		content := ""
+		if key != nil {
+			content = knownhosts.Line([]string{server.address()}, key) + "\n"
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	known := writeKnownHosts("known", server.key.PublicKey())
+	changed := writeKnownHosts("changed", newSigner(t).PublicKey())
+	empty := writeKnownHosts("empty", nil)
+
+	testCases := []struct {
+		name     string
+		hostKeys *HostKeyVerification
+		pinned   interface{}
+		err      string
+	}{
+		{name: "no verification"},
+		{name: "known host", hostKeys: &HostKeyVerification{KnownHostsFile: known}},
+		{
+			name:     "unknown host",
+			hostKeys: &HostKeyVerification{KnownHostsFile: empty},
+			err:      "is unknown, it's not present in",
+		},
+		{
+			name:     "changed key",
+			hostKeys: &HostKeyVerification{KnownHostsFile: changed, TrustOnFirstUse: true},
+			err:      "has changed",
+		},
+		{
+			name:     "missing known_hosts file",
+			hostKeys: &HostKeyVerification{KnownHostsFile: filepath.Join(dir, "missing")},
+			err:      "problem reading known_hosts file",
+		},
+		{name: "pinned fingerprint", pinned: ssh.FingerprintSHA256(server.key.PublicKey())},
+		{
+			name:     "pinned fingerprints take precedence",
+			hostKeys: &HostKeyVerification{KnownHostsFile: changed},
+			pinned:   []interface{}{"SHA256:nope", ssh.FingerprintLegacyMD5(server.key.PublicKey())},
+		},
+		{
+			name:   "wrong pinned fingerprint",
+			pinned: []string{ssh.FingerprintSHA256(newSigner(t).PublicKey())},
+			err:    "doesn't match any of the pinned fingerprints",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			host := server.host()
+			if tc.pinned != nil {
+				host.Data[HostKeyFingerprintsKey] = tc.pinned
+			}
+			conn, err := (&SSHOpen{HostKeys: tc.hostKeys}).Open(context.Background(), host)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				conn.Close(context.Background()) // nolint
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("got error %v, want one containing %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestHostKeyTrustOnFirstUse(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	dir, err := ioutil.TempDir("", "gornir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "known_hosts")
+
+	// first connection adds the key to the file, which is created
+	// if needed, and the second one verifies it
+	open := &SSHOpen{HostKeys: &HostKeyVerification{KnownHostsFile: path, TrustOnFirstUse: true}}
+	for i := 0; i < 2; i++ {
+		conn, err := open.Open(context.Background(), server.host())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close(context.Background()) // nolint
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := knownhosts.Line([]string{server.address()}, server.key.PublicKey()) + "\n"
+	if string(content) != expected {
+		t.Errorf("got known_hosts %q, want %q", content, expected)
+	}
+
+}
+
+func TestHostKeyAlgorithms(t *testing.T) {
+	// the server has a key of a different type than the one the client prefers
+	priv, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, other)
+	defer server.close()
+
+	dir, err := ioutil.TempDir("", "gornir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "known_hosts")
+	content := knownhosts.Line([]string{server.address()}, other.PublicKey()) + "\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server is asked for the key on record instead of reporting the key changed
+	conn, err := (&SSHOpen{HostKeys: &HostKeyVerification{KnownHostsFile: path}}).Open(context.Background(), server.host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close(context.Background()) // nolint
+}
@@ -0,0 +1,266 @@
+package connection
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// Keys in the Extras of the "ssh" gornir.ConnectionOptions to reach each host through
+// jump hosts or a proxy. They override the values set in SSHOpen
+const (
+	ProxyJumpKey = "proxy_jump" // Jump host, or list of them, in the format [user@]host[:port]
+	ProxyKey     = "proxy"      // SOCKS5 proxy in the format socks5://[user:password@]host[:port]
+)
+
+// JumpHostAuth are the credentials SSHOpen uses to authenticate against the jump hosts.
+// The credentials of the devices are never offered to the jump hosts
+type JumpHostAuth struct {
+	Username string // User for the jump hosts that don't set one, the one of the device if empty
+	Password string // Password for the password and keyboard-interactive methods
+	Auth            // Methods and private keys to use, publickey and agent followed by password and keyboard-interactive, if there is a Password, by default
+}
+
+// methods returns the methods to try in order. Unless set, the keys in the agent and in
+// PrivateKeyFiles are tried and, if there is a password, the password based methods
+func (a JumpHostAuth) methods() []string {
+	if len(a.Methods) > 0 {
+		return a.Methods
+	}
+	methods := []string{AuthPublicKey, AuthAgent}
+	if a.Password != "" {
+		methods = append(methods, AuthPassword, AuthKeyboardInteractive)
+	}
+	return methods
+}
+
+// clientConfig builds the client configuration for the jump hosts. The returned key identifies
+// the credentials so connections to the jump hosts are only shared by devices using the same ones.
+// The returned function releases the resources used for the authentication
+func (a JumpHostAuth) clientConfig(user string, hostKeyCallback ssh.HostKeyCallback, timeout time.Duration, logger gornir.Logger) (*ssh.ClientConfig, string, func(), error) {
+	if a.Username != "" {
+		user = a.Username
+	}
+	auth := a.Auth
+	auth.Methods = a.methods()
+	// only the credentials of the jump hosts, never the Extras of the device
+	opts := gornir.ConnectionOptions{Username: user, Password: a.Password, Extras: map[string]interface{}{}}
+	methods, release, err := auth.authMethods(opts, logger)
+	if err != nil {
+		return nil, "", nil, errors.Wrap(err, "problem building jump host authentication")
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %q %q", auth.Methods, auth.PrivateKeyFiles, auth.PrivateKeyPassphrase, a.Password) // nolint
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            methods,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	}
+	return config, hex.EncodeToString(h.Sum(nil)), release, nil
+}
+
+// jumpHost is one of the intermediate hosts to reach a device
+type jumpHost struct {
+	user string
+	addr string
+}
+
+// parseJumpHosts parses a list of jump hosts in the format [user@]host[:port],
+// either as independent elements or separated by commas like OpenSSH does.
+// If cfg is set, the settings for each host are looked up in it. Jump hosts
+// that don't specify a user, neither directly nor in cfg, use defaultUser
+func parseJumpHosts(specs []string, defaultUser string, cfg *sshConfig) ([]jumpHost, error) {
+	hosts := []jumpHost{}
+	for _, spec := range specs {
+		for _, s := range strings.Split(spec, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			j := jumpHost{}
+			if i := strings.LastIndex(s, "@"); i >= 0 {
+				j.user, s = s[:i], s[i+1:]
+			}
+			host, port := s, ""
+			if h, p, err := net.SplitHostPort(s); err == nil {
+				host, port = h, p
+			} else if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+				host = s[1 : len(s)-1]
+			}
+			if host == "" {
+				return nil, errors.Errorf("invalid jump host '%s'", spec)
+			}
+			if cfg != nil {
+				settings, err := cfg.lookup(host)
+				if err != nil {
+					return nil, err
+				}
+				if settings.hostname != "" {
+					host = settings.hostname
+				}
+				if j.user == "" {
+					j.user = settings.user
+				}
+				if port == "" && settings.port != 0 {
+					port = strconv.Itoa(int(settings.port))
+				}
+			}
+			if j.user == "" {
+				j.user = defaultUser
+			}
+			if port == "" {
+				port = "22"
+			}
+			if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+				return nil, errors.Errorf("invalid port in jump host '%s'", spec)
+			}
+			j.addr = net.JoinHostPort(host, port)
+			hosts = append(hosts, j)
+		}
+	}
+	return hosts, nil
+}
+
+// bastion is a connection to a jump host shared by all the connections going through it
+type bastion struct {
+	client *ssh.Client
+	err    error
+	ready  chan struct{} // closed once the connection is established or failed
+	refs   int
+}
+
+// bastionCache keeps the connections to the jump hosts so they are reused across devices.
+// Connections are closed once no device uses them anymore and forgotten as soon as they
+// die so devices connecting afterwards don't try to go through them
+type bastionCache struct {
+	mux      sync.Mutex
+	bastions map[string]*bastion
+}
+
+var bastions = &bastionCache{bastions: make(map[string]*bastion)}
+
+// acquire returns the connection identified by key establishing it with dial if needed.
+// Every successful call needs to be matched with a call to release
+func (c *bastionCache) acquire(ctx context.Context, key string, dial func() (*ssh.Client, error)) (*bastion, error) {
+	c.mux.Lock()
+	b, ok := c.bastions[key]
+	if ok {
+		b.refs++
+		c.mux.Unlock()
+		select {
+		case <-b.ready:
+		case <-ctx.Done():
+			// we are not waiting anymore so we give back the reference once it's ready
+			go func() {
+				<-b.ready
+				if b.err == nil {
+					c.release(key, b)
+				}
+			}()
+			return nil, errors.Wrap(ctx.Err(), "context done")
+		}
+		if b.err != nil {
+			// the failed connection was already removed from the cache
+			return nil, b.err
+		}
+		return b, nil
+	}
+	b = &bastion{ready: make(chan struct{}), refs: 1}
+	c.bastions[key] = b
+	c.mux.Unlock()
+
+	b.client, b.err = dial()
+	if b.err != nil {
+		// we don't want to keep failures around so next attempt can retry
+		c.forget(key, b)
+	} else {
+		go func() {
+			b.client.Wait() // nolint
+			c.forget(key, b)
+		}()
+	}
+	close(b.ready)
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b, nil
+}
+
+// forget removes the connection from the cache, if it's still the one identified by key
+func (c *bastionCache) forget(key string, b *bastion) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.bastions[key] == b {
+		delete(c.bastions, key)
+	}
+}
+
+// release decrements the references to the connection closing it if nobody else is using it
+func (c *bastionCache) release(key string, b *bastion) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	b.refs--
+	if b.refs > 0 {
+		return
+	}
+	if c.bastions[key] == b {
+		delete(c.bastions, key)
+	}
+	if b.client != nil {
+		b.client.Close() // nolint
+	}
+}
+
+// dialThrough returns a dialer that goes through the jump hosts, acquiring a connection to
+// each of them from the cache. via identifies the first dialer, i.e. the proxy it uses, and
+// credentials the credentials and the host key verification in config. If set, algorithms returns the host key algorithms
+// to ask each jump host for. The returned function releases the connections to the jump
+// hosts, it's safe to call it more than once
+func dialThrough(ctx context.Context, first dialer, via string, jumps []jumpHost, config *ssh.ClientConfig, credentials string, algorithms func(addr string) ([]string, error)) (dialer, func(), error) {
+	keys := []string{}
+	acquired := []*bastion{}
+	release := func() {
+		for i := len(acquired) - 1; i >= 0; i-- {
+			bastions.release(keys[i], acquired[i])
+		}
+	}
+	d := first
+	key := via + "|" + credentials
+	for _, j := range jumps {
+		key = key + "," + j.user + "@" + j.addr
+		jumpConfig := *config
+		jumpConfig.User = j.user
+		if algorithms != nil {
+			var err error
+			if jumpConfig.HostKeyAlgorithms, err = algorithms(j.addr); err != nil {
+				release()
+				return nil, nil, errors.Wrap(err, "failed to build host key verification")
+			}
+		}
+		previous := d
+		b, err := bastions.acquire(ctx, key, func() (*ssh.Client, error) {
+			return dialSSH(ctx, previous, j.addr, &jumpConfig)
+		})
+		if err != nil {
+			release()
+			return nil, nil, errors.Wrapf(err, "problem connecting to jump host %s", j.addr)
+		}
+		keys = append(keys, key)
+		acquired = append(acquired, b)
+		d = b.client
+	}
+	once := &sync.Once{}
+	return d, func() { once.Do(release) }, nil
+}
@@ -0,0 +1,411 @@
+package connection
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestParseJumpHosts(t *testing.T) {
+	testCases := []struct {
+		name     string
+		specs    []string
+		expected []jumpHost
+		err      bool
+	}{
+		{
+			name:     "host only",
+			specs:    []string{"bastion"},
+			expected: []jumpHost{{user: "default", addr: "bastion:22"}},
+		},
+		{
+			name:  "user and port",
+			specs: []string{"admin@bastion:2222", "[::1]", "root@[::1]:2222"},
+			expected: []jumpHost{
+				{user: "admin", addr: "bastion:2222"},
+				{user: "default", addr: "[::1]:22"},
+				{user: "root", addr: "[::1]:2222"},
+			},
+		},
+		{
+			name:  "comma separated",
+			specs: []string{"bastion1, admin@bastion2:2222"},
+			expected: []jumpHost{
+				{user: "default", addr: "bastion1:22"},
+				{user: "admin", addr: "bastion2:2222"},
+			},
+		},
+		{name: "wrong port", specs: []string{"bastion:port"}, err: true},
+		{name: "no host", specs: []string{"admin@"}, err: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseJumpHosts(tc.specs, "default", nil)
+			if tc.err {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got %+v, want %+v", got, tc.expected)
+			}
+		})
+	}
+}
+
+// waitForConnections waits until the server has the expected number of active connections
+func waitForConnections(t *testing.T, s *testServer, name string, active int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, got := s.connections()
+		if got == active {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: got %d active connections, want %d", name, got, active)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProxyJump(t *testing.T) {
+	bastion1 := newTestServer(t)
+	defer bastion1.close()
+	bastion2 := newTestServer(t)
+	defer bastion2.close()
+	targets := []*testServer{newTestServer(t), newTestServer(t), newTestServer(t)}
+	for _, target := range targets {
+		defer target.close()
+	}
+
+	open := &SSHOpen{ProxyJump: []string{bastion1.listener.Addr().String(), "gornir@" + bastion2.listener.Addr().String()}, JumpAuth: &JumpHostAuth{Password: "secret"}}
+	hosts := make([]*gornir.Host, len(targets))
+	for i, target := range targets {
+		hosts[i] = target.host()
+	}
+	// the last host overrides the jump hosts to skip the first one
+	hosts[2].ConnectionOptions = map[string]gornir.ConnectionOptions{
+		"ssh": {Extras: map[string]interface{}{ProxyJumpKey: bastion2.listener.Addr().String()}},
+	}
+
+	// open the connections concurrently, the jump hosts should be connected only once
+	conns := make([]gornir.Connection, len(hosts))
+	wg := &sync.WaitGroup{}
+	for i := range hosts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := open.Open(context.Background(), hosts[i])
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conns[i] = conn
+		}(i)
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+
+	for i, target := range targets {
+		if logins, _ := target.connections(); logins != 1 {
+			t.Errorf("target %d: got %d logins, want 1", i, logins)
+		}
+	}
+	if logins, _ := bastion1.connections(); logins != 1 {
+		t.Errorf("bastion1: got %d logins, want 1", logins)
+	}
+	// one connection through bastion1 and one directly
+	if logins, _ := bastion2.connections(); logins != 2 {
+		t.Errorf("bastion2: got %d logins, want 2", logins)
+	}
+
+	// jump hosts are only closed along the last connection that uses them
+	if err := conns[2].Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitForConnections(t, bastion2, "bastion2", 1)
+	if err := conns[0].Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitForConnections(t, bastion1, "bastion1", 1)
+	if err := conns[1].Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitForConnections(t, bastion1, "bastion1", 0)
+	waitForConnections(t, bastion2, "bastion2", 0)
+}
+
+// socks5Server is a minimal SOCKS5 proxy that requires the user "gornir" with password "secret"
+type socks5Server struct {
+	listener net.Listener
+	mux      sync.Mutex
+	requests []string // addresses the clients connected to
+}
+
+func newSOCKS5Server(t *testing.T) *socks5Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socks5Server{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socks5Server) handle(conn net.Conn) {
+	defer conn.Close()
+	greeting := make([]byte, 3)
+	if _, err := io.ReadFull(conn, greeting); err != nil || greeting[2] != socks5AuthPassword {
+		conn.Write([]byte{socks5Version, 0xff}) // nolint
+		return
+	}
+	conn.Write([]byte{socks5Version, socks5AuthPassword}) // nolint
+
+	readString := func() string {
+		l := make([]byte, 1)
+		io.ReadFull(conn, l) // nolint
+		s := make([]byte, l[0])
+		io.ReadFull(conn, s) // nolint
+		return string(s)
+	}
+	io.ReadFull(conn, make([]byte, 1)) // nolint
+	if readString() != "gornir" || readString() != "secret" {
+		conn.Write([]byte{socks5PasswordStatus, 1}) // nolint
+		return
+	}
+	conn.Write([]byte{socks5PasswordStatus, 0}) // nolint
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil || req[3] != socks5AddrIPv4 {
+		return
+	}
+	addr := make([]byte, net.IPv4len+2)
+	if _, err := io.ReadFull(conn, addr); err != nil {
+		return
+	}
+	target := net.JoinHostPort(net.IP(addr[:4]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(addr[4:]))))
+	s.mux.Lock()
+	s.requests = append(s.requests, target)
+	s.mux.Unlock()
+
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		conn.Write([]byte{socks5Version, 5, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0}) // nolint
+		return
+	}
+	conn.Write([]byte{socks5Version, 0, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0}) // nolint
+	pipe(conn, upstream)
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	proxy := newSOCKS5Server(t)
+	defer proxy.listener.Close()
+	bastion := newTestServer(t)
+	defer bastion.close()
+	target := newTestServer(t)
+	defer target.close()
+
+	testCases := []struct {
+		name      string
+		open      *SSHOpen
+		extras    map[string]interface{}
+		requested string
+		err       bool
+	}{
+		{
+			name:      "proxy set in SSHOpen",
+			open:      &SSHOpen{Proxy: "socks5://gornir:secret@" + proxy.listener.Addr().String()},
+			requested: target.listener.Addr().String(),
+		},
+		{
+			name:      "proxy to reach the jump host set in the host",
+			open:      &SSHOpen{ProxyJump: []string{bastion.listener.Addr().String()}, JumpAuth: &JumpHostAuth{Password: "secret"}},
+			extras:    map[string]interface{}{ProxyKey: "socks5://gornir:secret@" + proxy.listener.Addr().String()},
+			requested: bastion.listener.Addr().String(),
+		},
+		{
+			name:   "wrong credentials",
+			open:   &SSHOpen{Proxy: "socks5://gornir:wrong@" + proxy.listener.Addr().String()},
+			extras: map[string]interface{}{},
+			err:    true,
+		},
+		{
+			name: "unsupported proxy",
+			open: &SSHOpen{Proxy: "http://" + proxy.listener.Addr().String()},
+			err:  true,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			proxy.mux.Lock()
+			proxy.requests = nil
+			proxy.mux.Unlock()
+
+			host := target.host()
+			host.ConnectionOptions = map[string]gornir.ConnectionOptions{"ssh": {Extras: tc.extras}}
+			conn, err := tc.open.Open(context.Background(), host)
+			if tc.err {
+				if err == nil {
+					conn.Close(context.Background()) // nolint
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Close(context.Background()) // nolint
+
+			proxy.mux.Lock()
+			defer proxy.mux.Unlock()
+			if !cmp.Equal(proxy.requests, []string{tc.requested}) {
+				t.Errorf("proxy got requests %v, want [%s]", proxy.requests, tc.requested)
+			}
+		})
+	}
+}
+
+func TestJumpHostCredentials(t *testing.T) {
+	bastion := newTestServer(t)
+	defer bastion.close()
+	target := newTestServer(t)
+	defer target.close()
+
+	previous, wasSet := os.LookupEnv("SSH_AUTH_SOCK")
+	os.Unsetenv("SSH_AUTH_SOCK") // nolint
+	defer func() {
+		if wasSet {
+			os.Setenv("SSH_AUTH_SOCK", previous) // nolint
+		}
+	}()
+
+	jumps := []string{bastion.listener.Addr().String()}
+
+	// the password of the device is not offered to the jump host
+	conn, err := (&SSHOpen{ProxyJump: jumps}).Open(context.Background(), target.host())
+	if err == nil {
+		conn.Close(context.Background()) // nolint
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "none of the authentication methods") {
+		t.Errorf("got error %v, want one about the authentication methods", err)
+	}
+
+	open := &SSHOpen{ProxyJump: jumps, JumpAuth: &JumpHostAuth{Password: "secret"}}
+	conn, err = open.Open(context.Background(), target.host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background()) // nolint
+
+	// connections to the jump hosts are only shared with the same credentials
+	wrong := &SSHOpen{ProxyJump: jumps, JumpAuth: &JumpHostAuth{Password: "wrong"}}
+	if c, err := wrong.Open(context.Background(), target.host()); err == nil {
+		c.Close(context.Background()) // nolint
+		t.Error("expected an error with the wrong credentials")
+	}
+
+	// jump hosts that die are not reused even if there are devices behind them
+	bastion.disconnect()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		bastions.mux.Lock()
+		cached := len(bastions.bastions)
+		bastions.mux.Unlock()
+		if cached == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("dead jump host wasn't forgotten")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	again, err := open.Open(context.Background(), target.host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.Close(context.Background()) // nolint
+	if logins, _ := bastion.connections(); logins != 2 {
+		t.Errorf("bastion: got %d logins, want 2", logins)
+	}
+}
+
+func TestJumpHostKeyVerification(t *testing.T) {
+	bastion := newTestServer(t)
+	defer bastion.close()
+	target := newTestServer(t)
+	defer target.close()
+
+	dir, err := ioutil.TempDir("", "gornir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	empty := filepath.Join(dir, "empty")
+	if err := ioutil.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	known := filepath.Join(dir, "known")
+	content := knownhosts.Line([]string{bastion.address()}, bastion.key.PublicKey()) + "\n" +
+		knownhosts.Line([]string{target.address()}, target.key.PublicKey()) + "\n"
+	if err := ioutil.WriteFile(known, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	jumps := []string{bastion.listener.Addr().String()}
+	conn, err := (&SSHOpen{ProxyJump: jumps, JumpAuth: &JumpHostAuth{Password: "secret"}}).Open(context.Background(), target.host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background()) // nolint
+
+	// the connection to the jump host opened without verifying its key is not reused
+	strict := &SSHOpen{ProxyJump: jumps, JumpAuth: &JumpHostAuth{Password: "secret"}, HostKeys: &HostKeyVerification{KnownHostsFile: empty}}
+	if c, err := strict.Open(context.Background(), target.host()); err == nil {
+		c.Close(context.Background()) // nolint
+		t.Error("expected an error verifying the jump host")
+	} else if !strings.Contains(err.Error(), "problem connecting to jump host") {
+		t.Errorf("got error %v, want one connecting to the jump host", err)
+	}
+
+	strict.HostKeys.KnownHostsFile = known
+	c, err := strict.Open(context.Background(), target.host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close(context.Background()) // nolint
+	if logins, _ := bastion.connections(); logins != 2 {
+		t.Errorf("bastion: got %d logins, want 2", logins)
+	}
+}
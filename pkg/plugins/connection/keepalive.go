@@ -0,0 +1,107 @@
+package connection
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// keepAliveRequest is the global request OpenSSH uses for its keepalives. Servers that
+// don't know it reply with a failure, which is enough to know the connection works
+const keepAliveRequest = "keepalive@openssh.com"
+
+// DefaultKeepAliveCountMax is the number of keepalives without answer after which
+// the connection is closed if SSHOpen doesn't set KeepAliveCountMax
+const DefaultKeepAliveCountMax = 3
+
+// DefaultHealthCheckTimeout is how long IsAlive waits for the server to answer
+// if SSHOpen doesn't set HealthCheckTimeout
+const DefaultHealthCheckTimeout = 10 * time.Second
+
+// recentlyAlive is how long after the server answered a keepalive the
+// connection is assumed to be alive without sending a new one
+const recentlyAlive = time.Second
+
+// IsAlive returns if the server answered a keepalive recently or, if it didn't, sends
+// one and returns if it's answered before the context is done or the health check
+// times out, see SSHOpen.HealthCheckTimeout. It implements gornir.HealthChecker
+func (s *SSH) IsAlive(ctx context.Context) bool {
+	if s.Client == nil {
+		return false
+	}
+	if last := atomic.LoadInt64(&s.lastAlive); last != 0 && time.Since(time.Unix(0, last)) < recentlyAlive {
+		return true
+	}
+	return s.ping(ctx)
+}
+
+// ping sends a keepalive and returns if the server answered it in time, recording when it did
+func (s *SSH) ping(ctx context.Context) bool {
+	timeout := s.healthCheckTimeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	res := make(chan error, 1)
+	go func() {
+		_, _, err := s.Client.SendRequest(keepAliveRequest, true, nil)
+		res <- err
+	}()
+	alive := false
+	select {
+	case err := <-res:
+		alive = err == nil
+	case <-ctx.Done():
+	}
+	if alive {
+		atomic.StoreInt64(&s.lastAlive, time.Now().UnixNano())
+	} else {
+		atomic.StoreInt64(&s.lastAlive, 0)
+	}
+	return alive
+}
+
+// keepAlive sends a keepalive every interval until done is closed. If countMax keepalives
+// in a row go unanswered for an interval the client is closed so the connection is
+// reported dead right away instead of hanging the next time it's used
+func (s *SSH) keepAlive(interval time.Duration, countMax int, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		alive := s.ping(ctx)
+		cancel()
+		if alive {
+			missed = 0
+			continue
+		}
+		missed++
+		if missed >= countMax {
+			s.Client.Close() // nolint
+			return
+		}
+	}
+}
+
+// startKeepAlive starts sending keepalives in the background, they are stopped when
+// the connection is closed. Nothing is done if interval is not positive
+func (s *SSH) startKeepAlive(interval time.Duration, countMax int) {
+	if interval <= 0 {
+		return
+	}
+	if countMax <= 0 {
+		countMax = DefaultKeepAliveCountMax
+	}
+	done := make(chan struct{})
+	once := &sync.Once{}
+	s.stop = func() { once.Do(func() { close(done) }) }
+	go s.keepAlive(interval, countMax, done)
+}
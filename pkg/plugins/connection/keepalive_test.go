@@ -0,0 +1,122 @@
+package connection
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+)
+
+func TestKeepAlive(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	open := &SSHOpen{KeepAliveInterval: 20 * time.Millisecond, KeepAliveCountMax: 2}
+	conn, err := open.Open(context.Background(), server.host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background()) // nolint
+	sshConn := conn.(*SSH)
+
+	// keepalives are sent periodically and answered
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		server.mux.Lock()
+		keepAlives := server.keepAlives
+		server.mux.Unlock()
+		if keepAlives >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d keepalives, want at least 3", keepAlives)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !sshConn.IsAlive(context.Background()) {
+		t.Fatal("connection should be alive")
+	}
+
+	// once the server stops answering the connection is closed
+	server.mux.Lock()
+	server.unresponsive = true
+	server.mux.Unlock()
+	waitForConnections(t, server, "server", 0)
+	if sshConn.IsAlive(context.Background()) {
+		t.Error("connection should be dead")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	host := server.host()
+	first, err := host.GetConnectionContext(context.Background(), "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer host.CloseConnections(context.Background()) // nolint
+
+	// an unanswered check doesn't mean the connection is dead
+	server.mux.Lock()
+	server.unresponsive = true
+	server.mux.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := host.GetConnectionContext(ctx, "ssh"); err == nil {
+		t.Error("expected an error checking the connection")
+	}
+	server.mux.Lock()
+	server.unresponsive = false
+	server.mux.Unlock()
+
+	server.disconnect()
+	second, err := host.GetConnectionContext(context.Background(), "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Error("got the dead connection")
+	}
+	if logins, _ := server.connections(); logins != 2 {
+		t.Errorf("got %d logins, want 2", logins)
+	}
+	if !second.(gornir.HealthChecker).IsAlive(context.Background()) {
+		t.Error("new connection should be alive")
+	}
+}
+
+func TestReconnectSettings(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	// the connection is opened by a task, not by the registered factory
+	host := server.host()
+	open := &SSHOpen{HealthCheckTimeout: 50 * time.Millisecond}
+	if _, err := open.Run(context.Background(), nil, host); err != nil {
+		t.Fatal(err)
+	}
+	defer host.CloseConnections(context.Background()) // nolint
+
+	// checks time out on their own even if the context has no deadline
+	server.mux.Lock()
+	server.unresponsive = true
+	server.mux.Unlock()
+	start := time.Now()
+	conn, err := host.GetConnectionContext(context.Background(), "ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("checking the connection took %s", elapsed)
+	}
+	if logins, _ := server.connections(); logins != 2 {
+		t.Errorf("got %d logins, want 2", logins)
+	}
+	// and the new connection is opened with the same settings
+	if conn.(*SSH).opener != open {
+		t.Error("connection wasn't reopened with the SSHOpen it was opened with")
+	}
+}
@@ -0,0 +1,352 @@
+package connection
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is an in-process SSH server used to test the connection plugins
+type testServer struct {
+	listener     net.Listener
+	config       *ssh.ServerConfig
+	key          ssh.Signer        // host key of the server
+	userKey      *ecdsa.PrivateKey // key authorized to log in as "gornir"
+	mux          sync.Mutex
+	method       string // method used by the last client that authenticated
+	logins       int    // number of clients that authenticated
+	active       int    // number of clients currently connected
+	conns        []net.Conn
+	keepAlives   int      // number of keepalives received
+	unresponsive bool     // if set, global requests are never answered
+	commands     []string // commands received by the shells
+}
+
+// newPrivateKey generates a new private key
+func newPrivateKey(t *testing.T) *ecdsa.PrivateKey {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+// newSigner generates a new key
+func newSigner(t *testing.T) ssh.Signer {
+	signer, err := ssh.NewSignerFromKey(newPrivateKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// newTestServer starts a server accepting the user "gornir" with password "secret",
+// either with the password or keyboard-interactive methods, or with userKey. The
+// server presents its key or any of hostKeys. The server is stopped when calling close
+func newTestServer(t *testing.T, hostKeys ...ssh.Signer) *testServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userKey := newPrivateKey(t)
+	authorized, err := ssh.NewPublicKey(&userKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		listener: listener,
+		key:      newSigner(t),
+		userKey:  userKey,
+	}
+	s.config = &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "gornir" && string(pass) == "secret" {
+				return s.authenticated("password")
+			}
+			return nil, errWrongCredentials
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if c.User() == "gornir" && bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return s.authenticated("publickey")
+			}
+			return nil, errWrongCredentials
+		},
+		KeyboardInteractiveCallback: func(c ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("", "", []string{"Username: ", "Password: "}, []bool{true, false})
+			if err != nil {
+				return nil, err
+			}
+			if c.User() == "gornir" && answers[1] == "secret" {
+				return s.authenticated("keyboard-interactive")
+			}
+			return nil, errWrongCredentials
+		},
+	}
+	s.config.AddHostKey(s.key)
+	for _, key := range hostKeys {
+		s.config.AddHostKey(key)
+	}
+	go s.serve()
+	return s
+}
+
+var errWrongCredentials = errors.New("wrong credentials")
+
+func (s *testServer) authenticated(method string) (*ssh.Permissions, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.method = method
+	return nil, nil
+}
+
+// authMethod returns the method used by the last client that authenticated
+func (s *testServer) authMethod() string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.method
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	s.mux.Lock()
+	s.logins++
+	s.active++
+	s.conns = append(s.conns, conn)
+	s.mux.Unlock()
+	defer func() {
+		s.mux.Lock()
+		s.active--
+		s.mux.Unlock()
+	}()
+
+	go s.globalRequests(reqs)
+	for ch := range chans {
+		switch ch.ChannelType() {
+		case "direct-tcpip":
+			go forward(ch)
+		case "session":
+			go s.session(ch)
+		default:
+			ch.Reject(ssh.UnknownChannelType, "not supported") // nolint
+		}
+	}
+}
+
+// globalRequests counts the keepalives and rejects them, like servers not
+// implementing them do, unless the server is unresponsive
+func (s *testServer) globalRequests(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		s.mux.Lock()
+		if req.Type == keepAliveRequest {
+			s.keepAlives++
+		}
+		unresponsive := s.unresponsive
+		s.mux.Unlock()
+		if !unresponsive && req.WantReply {
+			req.Reply(false, nil) // nolint
+		}
+	}
+}
+
+// forward implements the channels used by jump hosts to reach other hosts
+func forward(newCh ssh.NewChannel) {
+	var payload struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := ssh.Unmarshal(newCh.ExtraData(), &payload); err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error()) // nolint
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error()) // nolint
+		return
+	}
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		conn.Close() // nolint
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	pipe(ch, conn)
+}
+
+// session implements the exec and shell requests. The command "hang" runs until the
+// session is closed, "flood" writes output until then and "exit N" writes "failed" to stderr and exits with status N. Any
+// command is written back to the client and, unless told otherwise, exits successfully.
+// Shells emulate the CLI of a router, see cli
+func (s *testServer) session(newCh ssh.NewChannel) {
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close() // nolint
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req":
+			req.Reply(true, nil) // nolint
+			continue
+		case "shell":
+			req.Reply(true, nil) // nolint
+			go ssh.DiscardRequests(reqs)
+			s.cli(ch)
+			return
+		}
+		var payload struct{ Command string }
+		if req.Type != "exec" || ssh.Unmarshal(req.Payload, &payload) != nil {
+			req.Reply(false, nil) // nolint
+			continue
+		}
+		req.Reply(true, nil) // nolint
+		if payload.Command == "hang" {
+			// requests are only closed along the channel
+			ssh.DiscardRequests(reqs)
+			return
+		}
+		if payload.Command == "flood" {
+			go ssh.DiscardRequests(reqs)
+			for {
+				if _, err := ch.Write([]byte("output\n")); err != nil {
+					return
+				}
+			}
+		}
+		status := 0
+		if n, err := fmt.Sscanf(payload.Command, "exit %d", &status); n == 1 && err == nil {
+			ch.Stderr().Write([]byte("failed")) // nolint
+		}
+		ch.Write([]byte(payload.Command))                                                          // nolint
+		ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)})) // nolint
+		return
+	}
+}
+
+// cli emulates the CLI of a router with the prompts "router#" and "router(config)#",
+// echoing the commands like a terminal would. Commands are recorded and, outside of
+// configuration mode, answered with two lines. In configuration mode, commands starting
+// with "invalid" are rejected. The command "hang" never returns the prompt and "split"
+// pauses after writing a line that looks like a prompt
+func (s *testServer) cli(ch ssh.Channel) {
+	mode := ""
+	prompt := func() {
+		fmt.Fprintf(ch, "\x1b[Krouter%s#", mode) // nolint
+	}
+	fmt.Fprint(ch, "Welcome to the router\r\n\r\n") // nolint
+	prompt()
+	reader := bufio.NewReader(ch)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		fmt.Fprintf(ch, "%s\r\n", line) // nolint
+		s.mux.Lock()
+		s.commands = append(s.commands, line)
+		s.mux.Unlock()
+		switch {
+		case line == "hang":
+			continue
+		case line == "split":
+			fmt.Fprint(ch, "interface to-core\r\nto-core#") // nolint
+			time.Sleep(100 * time.Millisecond)
+			fmt.Fprint(ch, " shutdown\r\n") // nolint
+		case line == "exit":
+			return
+		case line == "configure terminal":
+			mode = "(config)"
+		case line == "end":
+			mode = ""
+		case strings.HasPrefix(line, "invalid") && mode != "":
+			fmt.Fprint(ch, "              ^\r\n% Invalid input detected at '^' marker.\r\n\r\n") // nolint
+		case line != "" && mode == "":
+			fmt.Fprintf(ch, "output of %s\r\nsecond line\r\n", line) // nolint
+		}
+		prompt()
+	}
+}
+
+// pipe copies data between both connections until one of them is closed
+func pipe(a, b io.ReadWriteCloser) {
+	done := make(chan struct{}, 2)
+	cp := func(dst io.Writer, src io.Reader) {
+		io.Copy(dst, src) // nolint
+		done <- struct{}{}
+	}
+	go cp(a, b)
+	go cp(b, a)
+	<-done
+	a.Close() // nolint
+	b.Close() // nolint
+}
+
+// connections returns how many clients authenticated and how many are still connected
+func (s *testServer) connections() (int, int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.logins, s.active
+}
+
+// disconnect drops the connections of all the clients
+func (s *testServer) disconnect() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, conn := range s.conns {
+		conn.Close() // nolint
+	}
+	s.conns = nil
+}
+
+func (s *testServer) close() {
+	s.listener.Close() // nolint
+}
+
+// host returns a gornir.Host pointing to the server
+func (s *testServer) host() *gornir.Host {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return &gornir.Host{
+		Hostname: addr.IP.String(),
+		Port:     uint16(addr.Port),
+		Username: "gornir",
+		Password: "secret",
+		Data:     make(map[string]interface{}),
+	}
+}
+
+// address returns the address of the server as written in known_hosts files
+func (s *testServer) address() string {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return "[" + addr.IP.String() + "]:" + strconv.Itoa(addr.Port)
+}
@@ -0,0 +1,330 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultShellTimeout is how long a Shell waits for the device to answer if
+// ShellOptions doesn't set a Timeout
+const DefaultShellTimeout = 10 * time.Second
+
+// ShellOptions configures an interactive shell. The settings for each platform
+// can be found in the platform package
+type ShellOptions struct {
+	Prompt         string        // Regular expression matching the prompt, which must be the last line of the output
+	DisablePaging  []string      // Commands sent once the shell is opened to disable paging
+	ConfigMode     []string      // Commands to enter configuration mode
+	ExitConfigMode []string      // Commands to exit configuration mode
+	AbortConfig    []string      // Commands to discard the changes, if possible, and exit configuration mode when a command is rejected
+	SaveConfig     []string      // Commands to save the configuration
+	ConfigErrors   []string      // Regular expressions matching the output of configuration commands the device rejected
+	Timeout        time.Duration // How long to wait for the prompt, DefaultShellTimeout if zero
+	Term           string        // Terminal type, "vt100" if empty
+	Width          int           // Columns of the terminal, 511 if zero so lines are not wrapped
+	Height         int           // Rows of the terminal, 24 if zero
+}
+
+// genericPrompt matches the prompt of most devices, i.e. "router#", "switch>" or "user@host:~$"
+const genericPrompt = `[\w.@:~/()\[\]-]+\s?[>#$%]\s?$`
+
+// promptBase matches the part of the prompt that doesn't change with the mode of the CLI, i.e. "router" in "router(config)#"
+var promptBase = regexp.MustCompile(`^[\w.@-]+`)
+
+// escapeSequences matches the ANSI escape sequences devices use to move the cursor or colour the output
+var escapeSequences = regexp.MustCompile(`\x1b(\[[0-9;?]*[A-Za-z]|[()][A-Za-z0-9]|[=>])`)
+
+// Shell is an interactive shell on a PTY, for devices that don't support running
+// commands directly. Output is normalized removing carriage returns and ANSI
+// escape sequences. The prompt found when the shell is opened is learned, so the
+// following ones must start with the same hostname, which must be kept while the
+// shell is open. It's not safe for concurrent use
+type Shell struct {
+	session      *ssh.Session
+	stdin        io.WriteCloser
+	prompt       *regexp.Regexp   // opts.Prompt anchored at the start of the line
+	base         string           // learned beginning of the prompt, i.e. the hostname
+	configErrors []*regexp.Regexp // patterns of rejected configuration commands
+	opts         ShellOptions
+
+	mux     sync.Mutex
+	buf     bytes.Buffer  // output not consumed yet
+	err     error         // error reading the output, if any
+	updated chan struct{} // signaled when buf or err change
+}
+
+// Shell opens an interactive shell on a new session and waits for the prompt, disabling
+// paging afterwards. Opening the shell is aborted if the context is done
+func (s *SSH) Shell(ctx context.Context, opts ShellOptions) (*Shell, error) {
+	if opts.Prompt == "" {
+		opts.Prompt = genericPrompt
+	}
+	prompt, err := regexp.Compile(`^(?:` + opts.Prompt + `)`)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid prompt")
+	}
+	configErrors := make([]*regexp.Regexp, len(opts.ConfigErrors))
+	for i, pattern := range opts.ConfigErrors {
+		if configErrors[i], err = regexp.Compile(pattern); err != nil {
+			return nil, errors.Wrap(err, "invalid configuration error pattern")
+		}
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultShellTimeout
+	}
+	if opts.Term == "" {
+		opts.Term = "vt100"
+	}
+	if opts.Width == 0 {
+		opts.Width = 511
+	}
+	if opts.Height == 0 {
+		opts.Height = 24
+	}
+
+	session, err := s.NewSession(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create session")
+	}
+	sh := &Shell{session: session, prompt: prompt, configErrors: configErrors, opts: opts, updated: make(chan struct{}, 1)}
+	var stdout io.Reader
+	err = withContext(ctx, session, func() error {
+		modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+		if err := session.RequestPty(opts.Term, opts.Height, opts.Width, modes); err != nil {
+			return errors.Wrap(err, "failed to request pty")
+		}
+		var err error
+		if sh.stdin, err = session.StdinPipe(); err != nil {
+			return err
+		}
+		if stdout, err = session.StdoutPipe(); err != nil {
+			return err
+		}
+		return errors.Wrap(session.Shell(), "failed to start shell")
+	})
+	if err != nil {
+		session.Close() // nolint
+		return nil, err
+	}
+	go sh.read(stdout)
+
+	out, err := sh.expectPrompt(ctx, nil)
+	if err != nil {
+		sh.Close() // nolint
+		return nil, errors.Wrap(err, "failed to find prompt")
+	}
+	sh.base = promptBase.FindString(lastLine(out))
+	for _, cmd := range opts.DisablePaging {
+		if _, err := sh.send(ctx, cmd, nil); err != nil {
+			sh.Close() // nolint
+			return nil, errors.Wrap(err, "failed to disable paging")
+		}
+	}
+	return sh, nil
+}
+
+// read stores the output of the shell until it's closed
+func (sh *Shell) read(stdout io.Reader) {
+	chunk := make([]byte, 4096)
+	for {
+		n, err := stdout.Read(chunk)
+		out := strings.Replace(string(chunk[:n]), "\r", "", -1)
+		out = escapeSequences.ReplaceAllString(out, "")
+		sh.mux.Lock()
+		sh.buf.WriteString(out)
+		sh.err = err
+		sh.mux.Unlock()
+		select {
+		case sh.updated <- struct{}{}:
+		default:
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Expect waits until the output matches re, returning the output up to the end of the
+// match, which is consumed. It fails if the match doesn't happen within the Timeout
+// of the shell, if the shell is closed or if the context is done
+func (sh *Shell) Expect(ctx context.Context, re *regexp.Regexp) (string, error) {
+	return sh.expect(ctx, re.String(), func(out string) int {
+		if loc := re.FindStringIndex(out); loc != nil {
+			return loc[1]
+		}
+		return -1
+	}, nil)
+}
+
+// expectPrompt waits until the last line of the output is the prompt, see expect
+func (sh *Shell) expectPrompt(ctx context.Context, progress func(string)) (string, error) {
+	return sh.expect(ctx, sh.opts.Prompt, func(out string) int {
+		start := len(out) - len(lastLine(out))
+		if !strings.HasPrefix(out[start:], sh.base) {
+			return -1
+		}
+		if loc := sh.prompt.FindStringIndex(out[start:]); loc != nil {
+			return start + loc[1]
+		}
+		return -1
+	}, progress)
+}
+
+// expect waits until match returns the end of what it's waiting for in the output, or -1
+// if it's not found yet. what describes it in the errors. If set, progress is called with
+// the output read so far, which only grows, every time it changes
+func (sh *Shell) expect(ctx context.Context, what string, match func(string) int, progress func(string)) (string, error) {
+	timer := time.NewTimer(sh.opts.Timeout)
+	defer timer.Stop()
+	for {
+		sh.mux.Lock()
+		out := sh.buf.String()
+		end := match(out)
+		if end >= 0 {
+			sh.buf.Next(end)
+			out = out[:end]
+		}
+		err := sh.err
+		sh.mux.Unlock()
+		if progress != nil {
+			progress(out)
+		}
+		if end >= 0 {
+			return out, nil
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "shell closed while waiting for '%s'", what)
+		}
+
+		select {
+		case <-sh.updated:
+		case <-timer.C:
+			return "", errors.Errorf("timed out after %s waiting for '%s'", sh.opts.Timeout, what)
+		case <-ctx.Done():
+			return "", errors.Wrap(ctx.Err(), "context done")
+		}
+	}
+}
+
+// send writes the command and waits for the prompt, returning the output as it is.
+// progress, if set, is called as the output is read, see expect
+func (sh *Shell) send(ctx context.Context, cmd string, progress func(string)) (string, error) {
+	if _, err := io.WriteString(sh.stdin, cmd+"\n"); err != nil {
+		return "", errors.Wrapf(err, "failed to send '%s'", cmd)
+	}
+	out, err := sh.expectPrompt(ctx, progress)
+	return out, errors.Wrapf(err, "failed to run '%s'", cmd)
+}
+
+// SendCommand runs the command and returns its output, without the echoed command
+// and the prompt that follows it
+func (sh *Shell) SendCommand(ctx context.Context, cmd string) (string, error) {
+	return sh.SendCommandStream(ctx, cmd, nil)
+}
+
+// SendCommandStream runs the command like SendCommand does, writing the lines of the
+// output to w, if set, as they are read so long running commands can be followed
+func (sh *Shell) SendCommandStream(ctx context.Context, cmd string, w io.Writer) (string, error) {
+	var progress func(string)
+	if w != nil {
+		written := 0 // bytes of the output already written or skipped
+		progress = func(out string) {
+			end := strings.LastIndex(out, "\n") + 1
+			if end <= written {
+				return
+			}
+			lines := out[written:end]
+			if written == 0 && isEcho(out, cmd) {
+				lines = lines[strings.Index(lines, "\n")+1:]
+			}
+			written = end
+			w.Write([]byte(lines)) // nolint
+		}
+	}
+	out, err := sh.send(ctx, cmd, progress)
+	if err != nil {
+		return "", err
+	}
+	if isEcho(out, cmd) {
+		out = out[strings.Index(out, "\n")+1:]
+	}
+	out = out[:len(out)-len(lastLine(out))]
+	return strings.TrimRight(out, "\n"), nil
+}
+
+// isEcho returns whether the first line of out, which must be complete, is the command
+// echoed back by the device
+func isEcho(out, cmd string) bool {
+	i := strings.Index(out, "\n")
+	return i >= 0 && strings.HasSuffix(strings.TrimSpace(out[:i]), strings.TrimSpace(cmd))
+}
+
+// lastLine returns the text after the last newline of out
+func lastLine(out string) string {
+	return out[strings.LastIndex(out, "\n")+1:]
+}
+
+// sendAll runs the commands in order writing the output, as it is, to transcript
+func (sh *Shell) sendAll(ctx context.Context, transcript *strings.Builder, cmds []string) error {
+	for _, cmd := range cmds {
+		out, err := sh.send(ctx, cmd, nil)
+		transcript.WriteString(out)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendConfigSet enters configuration mode, runs the commands and exits configuration
+// mode. It returns the whole session as it would be seen on a terminal. If the output
+// of a command matches any of the ConfigErrors the remaining commands are not sent
+// and AbortConfig is run instead of ExitConfigMode
+func (sh *Shell) SendConfigSet(ctx context.Context, cmds []string) (string, error) {
+	transcript := &strings.Builder{}
+	if err := sh.sendAll(ctx, transcript, sh.opts.ConfigMode); err != nil {
+		return transcript.String(), errors.Wrap(err, "failed to enter configuration mode")
+	}
+	for _, cmd := range cmds {
+		out, err := sh.send(ctx, cmd, nil)
+		transcript.WriteString(out)
+		if err != nil {
+			return transcript.String(), err
+		}
+		for _, re := range sh.configErrors {
+			if match := re.FindString(out); match != "" {
+				err := errors.Errorf("device rejected '%s': %s", cmd, match)
+				if abortErr := sh.sendAll(ctx, transcript, sh.opts.AbortConfig); abortErr != nil {
+					err = errors.Wrapf(err, "failed to abort configuration (%s)", abortErr)
+				}
+				return transcript.String(), err
+			}
+		}
+	}
+	if err := sh.sendAll(ctx, transcript, sh.opts.ExitConfigMode); err != nil {
+		return transcript.String(), errors.Wrap(err, "failed to exit configuration mode")
+	}
+	return transcript.String(), nil
+}
+
+// SaveConfig runs the commands to save the configuration, if any, and returns the
+// whole session as it would be seen on a terminal
+func (sh *Shell) SaveConfig(ctx context.Context) (string, error) {
+	transcript := &strings.Builder{}
+	err := sh.sendAll(ctx, transcript, sh.opts.SaveConfig)
+	return transcript.String(), errors.Wrap(err, "failed to save configuration")
+}
+
+// Close closes the shell
+func (sh *Shell) Close() error {
+	sh.stdin.Close() // nolint
+	return sh.session.Close()
+}
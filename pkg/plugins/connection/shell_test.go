@@ -0,0 +1,186 @@
+package connection
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShell(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	conn, err := (&SSHOpen{}).Open(context.Background(), server.host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background()) // nolint
+	opts := ShellOptions{
+		Prompt:         `router(\(config\))?#$`,
+		DisablePaging:  []string{"terminal length 0"},
+		ConfigMode:     []string{"configure terminal"},
+		ExitConfigMode: []string{"end"},
+		SaveConfig:     []string{"write memory"},
+		AbortConfig:    []string{"end"},
+		ConfigErrors:   []string{`% Invalid input.*`},
+		Timeout:        200 * time.Millisecond,
+	}
+	sh, err := conn.(*SSH).Shell(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close() // nolint
+
+	out, err := sh.SendCommand(context.Background(), "show version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "output of show version\nsecond line"; out != expected {
+		t.Errorf("got %q, want %q", out, expected)
+	}
+
+	out, err = sh.SendConfigSet(context.Background(), []string{"hostname router", "ntp server 10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "configure terminal\nrouter(config)#hostname router\nrouter(config)#ntp server 10.0.0.1\nrouter(config)#end\nrouter#"
+	if out != expected {
+		t.Errorf("got %q, want %q", out, expected)
+	}
+
+	out, err = sh.SaveConfig(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "write memory\noutput of write memory\nsecond line\nrouter#"; out != expected {
+		t.Errorf("got %q, want %q", out, expected)
+	}
+
+	server.mux.Lock()
+	commands := server.commands
+	server.mux.Unlock()
+	expectedCommands := []string{"terminal length 0", "show version", "configure terminal", "hostname router", "ntp server 10.0.0.1", "end", "write memory"}
+	if !reflect.DeepEqual(commands, expectedCommands) {
+		t.Errorf("got commands %q, want %q", commands, expectedCommands)
+	}
+
+	out, err = sh.SendConfigSet(context.Background(), []string{"invalid command", "hostname other"})
+	if err == nil || !strings.Contains(err.Error(), "device rejected 'invalid command': % Invalid input detected at '^' marker.") {
+		t.Errorf("got error %v, want the command to be rejected", err)
+	}
+	if expected := "router(config)#end\nrouter#"; !strings.HasSuffix(out, expected) {
+		t.Errorf("got %q, want it to end with %q", out, expected)
+	}
+	server.mux.Lock()
+	commands = server.commands[len(expectedCommands):]
+	server.mux.Unlock()
+	if expected := []string{"configure terminal", "invalid command", "end"}; !reflect.DeepEqual(commands, expected) {
+		t.Errorf("got commands %q, want %q", commands, expected)
+	}
+
+	_, err = sh.SendCommand(context.Background(), "hang")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("got error %v, want a timeout", err)
+	}
+}
+
+func TestShellWrongPrompt(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	conn, err := (&SSHOpen{}).Open(context.Background(), server.host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background()) // nolint
+	opts := ShellOptions{Prompt: `switch>$`, Timeout: 100 * time.Millisecond}
+	if _, err := conn.(*SSH).Shell(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "failed to find prompt") {
+		t.Errorf("got error %v, want one finding the prompt", err)
+	}
+	opts.Prompt = `(`
+	if _, err := conn.(*SSH).Shell(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "invalid prompt") {
+		t.Errorf("got error %v, want an invalid prompt", err)
+	}
+}
+
+// TestShellPromptInOutput checks output looking like a prompt isn't taken as such,
+// even if the rest of the line arrives later
+func TestShellPromptInOutput(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	conn, err := (&SSHOpen{}).Open(context.Background(), server.host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background()) // nolint
+	opts := ShellOptions{Prompt: `[\w.-]+(\(config[\w.-]*\))?[>#]\s?$`, Timeout: time.Second}
+	sh, err := conn.(*SSH).Shell(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close() // nolint
+
+	out, err := sh.SendCommand(context.Background(), "split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "interface to-core\nto-core# shutdown"; out != expected {
+		t.Errorf("got %q, want %q", out, expected)
+	}
+	out, err = sh.SendCommand(context.Background(), "show version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "output of show version\nsecond line"; out != expected {
+		t.Errorf("got %q, want %q", out, expected)
+	}
+}
+
+// chunkWriter records each of the writes and when the first one happened
+type chunkWriter struct {
+	chunks []string
+	first  time.Time
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	if len(w.chunks) == 0 {
+		w.first = time.Now()
+	}
+	w.chunks = append(w.chunks, string(p))
+	return len(p), nil
+}
+
+func TestShellStream(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	conn, err := (&SSHOpen{}).Open(context.Background(), server.host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background()) // nolint
+	sh, err := conn.(*SSH).Shell(context.Background(), ShellOptions{Prompt: `router#$`, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close() // nolint
+
+	w := &chunkWriter{}
+	out, err := sh.SendCommandStream(context.Background(), "split", w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the server pauses for 100ms after the first line
+	if elapsed := time.Since(w.first); elapsed < 50*time.Millisecond {
+		t.Errorf("first line was written %v before the command completed, want it as soon as it's read", elapsed)
+	}
+	if expected := "interface to-core\nto-core# shutdown"; out != expected {
+		t.Errorf("got %q, want %q", out, expected)
+	}
+	if expected := []string{"interface to-core\n", "to-core# shutdown\n"}; !reflect.DeepEqual(w.chunks, expected) {
+		t.Errorf("got chunks %q, want %q", w.chunks, expected)
+	}
+}
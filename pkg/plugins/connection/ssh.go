@@ -3,23 +3,52 @@ package connection
 import (
 	"context"
 	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/nornir-automation/gornir/pkg/gornir"
+	pluginlogger "github.com/nornir-automation/gornir/pkg/plugins/logger"
 
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
 )
 
 // SSH is a Connection plugins that connects to device via ss using the golang.org/x/crypto/ssh
-// package. Current implementation only supports authentication with a password and has
-// ssh.InsecureIgnoreHostKey set
+// package. See Auth for the supported authentication methods. Host keys are only verified
+// if SSHOpen is configured to do so, see HostKeyVerification
 type SSH struct {
-	Client *ssh.Client
+	lastAlive          int64 // last time, in unix nanoseconds, the server answered a keepalive
+	Client             *ssh.Client
+	opener             *SSHOpen      // opener the connection was opened with, used to reopen it
+	healthCheckTimeout time.Duration // how long IsAlive waits for the server to answer
+	release            func()        // releases the connections to the jump hosts, if any
+	stop               func()        // stops the keepalives, if any
+}
+
+// Reopen opens a new connection towards the host with the same settings this one
+// was opened with. It implements gornir.Reopener so dead connections are replaced
+// by gornir.Host.GetConnectionContext without losing the settings of the SSHOpen
+// they were opened with, i.e. its HostKeys or Auth
+func (s *SSH) Reopen(ctx context.Context, host *gornir.Host) (gornir.Connection, error) {
+	opener := s.opener
+	if opener == nil {
+		opener = &SSHOpen{}
+	}
+	return opener.Open(ctx, host)
 }
 
 // Close closes the connection
 func (s *SSH) Close(context.Context) error {
-	return s.Client.Close()
+	if s.stop != nil {
+		s.stop()
+	}
+	err := s.Client.Close()
+	if s.release != nil {
+		s.release()
+	}
+	return err
 }
 
 // String implemente Stringer interface
@@ -33,10 +62,34 @@ func (s SSH) String() string {
 // ClientConfigFn is an interface that allows users to implement their own SSH auth mechanisms
 type ClientConfigFn func(*gornir.Host, gornir.Logger) (*ssh.ClientConfig, error)
 
-// SSHOpen is a Connection plugin that opens a connection with a device
+// SSHOpen is a Connection plugin that opens a connection with a device, either
+// directly or going through the jump hosts in ProxyJump and the SOCKS5 Proxy, which
+// can also be set per host, see ProxyJumpKey and ProxyKey. Connections to the jump
+// hosts are shared by all the devices behind them using the same credentials and
+// host key verification, and closed along the last one.
+// Jump hosts are authenticated against with the credentials in JumpAuth, never
+// with the ones of the devices.
+// The key presented by the device is verified against the fingerprints pinned in the
+// host data under HostKeyFingerprintsKey or, if there are none, against the known_hosts
+// file set in HostKeys. If neither is set, the HostKeyCallback of the ssh.ClientConfig
+// is used, which in the default configuration accepts any key. If KeepAliveInterval is
+// set, keepalives are sent to the device and the connection is closed once
+// KeepAliveCountMax of them in a row go unanswered, like ServerAliveInterval and
+// ServerAliveCountMax do in OpenSSH. Before handing out a stored connection,
+// gornir.Host.GetConnectionContext checks it's alive unless the device answered a
+// keepalive recently, waiting at most HealthCheckTimeout for the answer
 type SSHOpen struct {
-	Meta           *gornir.TaskMetadata // Task metadata
-	ClientConfigFn ClientConfigFn       // SSH client configuration
+	Meta               *gornir.TaskMetadata // Task metadata
+	ClientConfigFn     ClientConfigFn       // SSH client configuration
+	HostKeys           *HostKeyVerification // How to verify the key of the hosts
+	Auth               *Auth                // How to authenticate, ignored if ClientConfigFn is set
+	ProxyJump          []string             // Jump hosts to go through, in order, in the format [user@]host[:port]
+	JumpAuth           *JumpHostAuth        // How to authenticate against the jump hosts, only with the keys in the agent if not set
+	Proxy              string               // SOCKS5 proxy to reach the device, or the first jump host, i.e. socks5://proxy:1080
+	SSHConfigFile      string               // OpenSSH client config file to read the settings of the hosts from, i.e. ~/.ssh/config
+	KeepAliveInterval  time.Duration        // How often to send keepalives, disabled if zero
+	KeepAliveCountMax  int                  // Keepalives without answer before closing the connection, DefaultKeepAliveCountMax if zero
+	HealthCheckTimeout time.Duration        // How long to wait for the device to answer when checking the connection, DefaultHealthCheckTimeout if zero
 }
 
 // Metadata returns the task metadata
@@ -44,40 +97,222 @@ func (t *SSHOpen) Metadata() *gornir.TaskMetadata {
 	return t.Meta
 }
 
-// defaultSSHClientConfig implements ClientConfigFn
-func defaultSSHClientConfig(host *gornir.Host, logger gornir.Logger) (*ssh.ClientConfig, error) {
+// connectionOptions returns the "ssh" ConnectionOptions of the host merged with the
+// settings found for its hostname in SSHConfigFile, if set. Settings of the host win
+// over the ones in the file, except for HostName which is used to reach the host
+// like the ssh command does. The parsed file is returned as well so the settings of
+// the jump hosts can be looked up
+func (t *SSHOpen) connectionOptions(host *gornir.Host) (gornir.ConnectionOptions, *sshConfig, error) {
+	opts := host.GetConnectionOptions("ssh")
+	if t.SSHConfigFile == "" {
+		return opts, nil, nil
+	}
+	cfg, err := readSSHConfig(t.SSHConfigFile)
+	if err != nil {
+		return opts, nil, err
+	}
+	settings, err := cfg.lookup(opts.Hostname)
+	if err != nil {
+		return opts, nil, err
+	}
+	if settings.hostname != "" {
+		opts.Hostname = settings.hostname
+	}
+	if opts.Username == "" {
+		opts.Username = settings.user
+	}
+	if opts.Port == 0 {
+		opts.Port = settings.port
+	}
+	if _, ok := opts.Extras[PrivateKeyFilesKey]; !ok && len(settings.identityFiles) > 0 {
+		files := []string{}
+		if t.Auth != nil {
+			files = append(files, t.Auth.PrivateKeyFiles...)
+		}
+		// like ssh, we ignore identity files that don't exist
+		for _, f := range settings.identityFiles {
+			if _, err := os.Stat(f); err == nil {
+				files = append(files, f)
+			}
+		}
+		opts.Extras[PrivateKeyFilesKey] = files
+	}
+	if _, ok := opts.Extras[ProxyJumpKey]; !ok && len(t.ProxyJump) == 0 && settings.proxyJump != "" {
+		if settings.proxyJump == "none" {
+			opts.Extras[ProxyJumpKey] = []string{}
+		} else {
+			opts.Extras[ProxyJumpKey] = settings.proxyJump
+		}
+	}
+	return opts, cfg, nil
+}
+
+// defaultSSHClientConfig builds the client configuration when no ClientConfigFn is set.
+// Credentials are taken from the "ssh" ConnectionOptions of the host. The returned
+// function releases the resources used for the authentication
+func (t *SSHOpen) defaultSSHClientConfig(opts gornir.ConnectionOptions, logger gornir.Logger) (*ssh.ClientConfig, func(), error) {
+	auth := Auth{}
+	if t.Auth != nil {
+		auth = *t.Auth
+	}
+	methods, release, err := auth.authMethods(opts, logger)
+	if err != nil {
+		return nil, nil, err
+	}
 	return &ssh.ClientConfig{
-		User: host.Username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(host.Password),
-		},
+		User:            opts.Username,
+		Auth:            methods,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}, nil // #nosec
+	}, release, nil // #nosec
 }
 
-// Run implements gornir.Task interface
-func (t *SSHOpen) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
-	clientConfigFn := defaultSSHClientConfig
+// Open opens a new SSH connection towards the host. Connecting to the host, and to the
+// jump hosts, is aborted if ctx is done, in which case the returned error wraps the
+// error of the context. It implements gornir.ConnectionFactory
+// so it can be registered with gornir.RegisterConnection to customize how connections
+// are opened lazily, i.e.:
+//
+//	gornir.RegisterConnection("ssh", (&connection.SSHOpen{ClientConfigFn: myConfigFn}).Open)
+func (t *SSHOpen) Open(ctx context.Context, host *gornir.Host) (gornir.Connection, error) {
+	return t.open(ctx, nil, host)
+}
+
+func (t *SSHOpen) open(ctx context.Context, logger gornir.Logger, host *gornir.Host) (*SSH, error) {
+	if logger == nil {
+		logger = pluginlogger.NewNull()
+	}
+	opts, sshCfg, err := t.connectionOptions(host)
+	if err != nil {
+		return &SSH{}, errors.Wrap(err, "failed to read ssh config")
+	}
+	var config *ssh.ClientConfig
 	if t.ClientConfigFn != nil { // The client specified a config
-		clientConfigFn = t.ClientConfigFn
+		config, err = t.ClientConfigFn(host, logger)
+	} else {
+		var release func()
+		config, release, err = t.defaultSSHClientConfig(opts, logger)
+		if err == nil {
+			defer release()
+		}
 	}
-	config, err := clientConfigFn(host, logger)
 	if err != nil {
 		return &SSH{}, errors.Wrap(err, "failed to build SSH client configuration")
 	}
-	port := host.Port
+	// jump hosts are verified with the known_hosts file, pinned fingerprints belong to the device
+	jumpHostKey := config.HostKeyCallback
+	if t.HostKeys != nil {
+		if jumpHostKey, err = t.HostKeys.callback(); err != nil {
+			return &SSH{}, errors.Wrap(err, "failed to build host key verification")
+		}
+	}
+	port := opts.Port
 	if port == 0 {
 		port = 22
 	}
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host.Hostname, port), config)
+	addr := net.JoinHostPort(opts.Hostname, strconv.Itoa(int(port)))
+	verifyHostKey, algorithms, err := hostKeyCallback(t.HostKeys, host, addr)
 	if err != nil {
+		return &SSH{}, errors.Wrap(err, "failed to build host key verification")
+	}
+	if verifyHostKey != nil {
+		config.HostKeyCallback = verifyHostKey
+	}
+	if len(config.HostKeyAlgorithms) == 0 {
+		config.HostKeyAlgorithms = algorithms
+	}
+
+	d, release, err := t.dialer(ctx, logger, opts, sshCfg, config, jumpHostKey)
+	if err != nil {
+		return &SSH{}, errors.Wrap(err, "failed to dial")
+	}
+	client, err := dialSSH(ctx, d, addr, config)
+	if err != nil {
+		release()
 		return &SSH{}, errors.Wrap(err, "failed to dial")
 	}
-	host.SetConnection("ssh", &SSH{client})
-	return &SSH{client}, nil
+	conn := &SSH{Client: client, opener: t, healthCheckTimeout: t.HealthCheckTimeout, release: release}
+	conn.startKeepAlive(t.KeepAliveInterval, t.KeepAliveCountMax)
+	return conn, nil
+}
+
+// dialer returns the dialer to reach the host going through the proxy and jump hosts
+// configured, if any, authenticating against the latter with JumpAuth. The returned
+// function releases the jump hosts
+func (t *SSHOpen) dialer(ctx context.Context, logger gornir.Logger, opts gornir.ConnectionOptions, sshCfg *sshConfig, config *ssh.ClientConfig, jumpHostKey ssh.HostKeyCallback) (dialer, func(), error) {
+	proxy := t.Proxy
+	if v, ok := opts.Extras[ProxyKey]; ok {
+		if proxy, ok = v.(string); !ok {
+			return nil, nil, errors.Errorf("%s must be a string, found %v", ProxyKey, v)
+		}
+	}
+	specs := t.ProxyJump
+	if v, ok := opts.Extras[ProxyJumpKey]; ok {
+		var err error
+		if specs, err = stringList(ProxyJumpKey, v); err != nil {
+			return nil, nil, err
+		}
+	}
+	auth := JumpHostAuth{}
+	if t.JumpAuth != nil {
+		auth = *t.JumpAuth
+	}
+	defaultUser := auth.Username
+	if defaultUser == "" {
+		defaultUser = config.User
+	}
+	jumps, err := parseJumpHosts(specs, defaultUser, sshCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var d dialer = &net.Dialer{Timeout: config.Timeout}
+	if proxy != "" {
+		if d, err = newSOCKS5Dialer(proxy, d); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(jumps) == 0 {
+		return d, func() {}, nil
+	}
+	jumpConfig, credentials, releaseAuth, err := auth.clientConfig(config.User, jumpHostKey, config.Timeout, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer releaseAuth()
+	var algorithms func(string) ([]string, error)
+	if t.HostKeys != nil {
+		algorithms = t.HostKeys.algorithms
+	}
+	return dialThrough(ctx, d, proxy, jumps, jumpConfig, t.jumpHostKeyID()+"|"+credentials, algorithms)
 }
 
-// SSHClose is a Connection plugin that closes an already opened ssh connection
+// jumpHostKeyID identifies how the keys of the jump hosts are verified, so connections to
+// them are only shared by devices verifying them the same way. The HostKeyCallback returned
+// by ClientConfigFn can't be compared so, without HostKeys, connections to the jump hosts
+// opened with it are only shared by the same SSHOpen
+func (t *SSHOpen) jumpHostKeyID() string {
+	switch {
+	case t.HostKeys != nil:
+		return fmt.Sprintf("known_hosts %s, trust on first use %t", t.HostKeys.KnownHostsFile, t.HostKeys.TrustOnFirstUse)
+	case t.ClientConfigFn != nil:
+		return fmt.Sprintf("client config of %p", t)
+	default:
+		return "insecure"
+	}
+}
+
+// Run implements gornir.Task interface. The connection is stored in the host
+// under the name "ssh", replacing any existing one
+func (t *SSHOpen) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	conn, err := t.open(ctx, logger, host)
+	if err != nil {
+		return conn, err
+	}
+	return conn, host.SetConnectionContext(ctx, "ssh", conn)
+}
+
+// SSHClose is a Connection plugin that closes an already opened ssh connection and
+// removes it from the host
 type SSHClose struct {
 	Meta *gornir.TaskMetadata // Task metadata
 }
@@ -89,13 +324,7 @@ func (t *SSHClose) Metadata() *gornir.TaskMetadata {
 
 // Run implements gornir.Task interface
 func (t *SSHClose) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
-	conn, err := host.GetConnection("ssh")
-	if err != nil {
-		return &SSH{}, errors.Wrap(err, "failed to retrieve connection")
-	}
-	sshConn := conn.(*SSH)
-
-	if err := sshConn.Close(ctx); err != nil {
+	if err := host.CloseConnection(ctx, "ssh"); err != nil {
 		return &SSH{}, errors.Wrap(err, "failed to close client")
 	}
 	return &SSH{}, nil
@@ -0,0 +1,293 @@
+package connection
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sshConfigHost contains the settings of an OpenSSH client config file gornir understands
+type sshConfigHost struct {
+	hostname      string
+	user          string
+	port          uint16
+	identityFiles []string
+	proxyJump     string
+}
+
+// sshConfigBlock is a Host block of an OpenSSH client config file
+type sshConfigBlock struct {
+	patterns []string
+	settings [][2]string // keyword, in lower case, and value in the order they appear
+}
+
+// sshConfig is a parsed OpenSSH client config file
+type sshConfig struct {
+	blocks []sshConfigBlock
+}
+
+// maxIncludeDepth is how many Include directives can be nested, like OpenSSH
+const maxIncludeDepth = 16
+
+// sshConfigParser parses OpenSSH client config files following their Include directives
+type sshConfigParser struct {
+	cfg    *sshConfig
+	block  *sshConfigBlock
+	ignore bool                  // settings belong to a Match block
+	files  map[string]fileStamps // files read so far
+}
+
+// fileStamps identify the version of a file to know when it changes
+type fileStamps struct {
+	modTime time.Time
+	size    int64
+}
+
+func newSSHConfigParser() *sshConfigParser {
+	return &sshConfigParser{
+		cfg:   &sshConfig{},
+		block: &sshConfigBlock{patterns: []string{"*"}},
+		files: make(map[string]fileStamps),
+	}
+}
+
+// parseSSHConfig parses an OpenSSH client config file. Settings that appear before any Host
+// block apply to all the hosts. Match blocks are not supported and are ignored entirely.
+// Include directives are followed, relative paths are relative to ~/.ssh like OpenSSH does
+// for user config files, and, like in OpenSSH, Host blocks in the included files don't
+// change the block the settings after the directive belong to
+func parseSSHConfig(r io.Reader) (*sshConfig, error) {
+	p := newSSHConfigParser()
+	if err := p.parse(r, 0); err != nil {
+		return nil, err
+	}
+	return p.finish(), nil
+}
+
+// finish returns the parsed config
+func (p *sshConfigParser) finish() *sshConfig {
+	p.cfg.blocks = append(p.cfg.blocks, *p.block)
+	return p.cfg
+}
+
+// parse parses the content of a config file included depth levels deep
+func (p *sshConfigParser) parse(r io.Reader, depth int) error {
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// keyword and arguments are separated by whitespace or by an optional "="
+		i := strings.IndexAny(line, " \t=")
+		if i < 0 {
+			return errors.Errorf("line %d: missing argument for '%s'", lineNumber, line)
+		}
+		keyword := strings.ToLower(line[:i])
+		value := strings.TrimSpace(line[i:])
+		value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+		value = strings.Trim(value, `"`)
+		if value == "" {
+			return errors.Errorf("line %d: missing argument for '%s'", lineNumber, keyword)
+		}
+
+		switch keyword {
+		case "host":
+			p.cfg.blocks = append(p.cfg.blocks, *p.block)
+			p.block = &sshConfigBlock{patterns: strings.Fields(value)}
+			p.ignore = false
+		case "match":
+			p.cfg.blocks = append(p.cfg.blocks, *p.block)
+			p.block = &sshConfigBlock{}
+			p.ignore = true
+		case "include":
+			if p.ignore {
+				continue
+			}
+			if err := p.include(value, depth); err != nil {
+				return errors.Wrapf(err, "line %d", lineNumber)
+			}
+		default:
+			if !p.ignore {
+				p.block.settings = append(p.block.settings, [2]string{keyword, value})
+			}
+		}
+	}
+	return errors.Wrap(scanner.Err(), "problem reading ssh config")
+}
+
+// include parses the files matching the glob patterns in value, in order
+func (p *sshConfigParser) include(value string, depth int) error {
+	if depth >= maxIncludeDepth {
+		return errors.New("too many nested includes")
+	}
+	patterns := p.block.patterns
+	blocks := len(p.cfg.blocks)
+	for _, pattern := range strings.Fields(value) {
+		pattern = expandHome(pattern)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(expandHome("~/.ssh"), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return errors.Wrapf(err, "invalid include '%s'", pattern)
+		}
+		for _, path := range matches {
+			if err := p.parseFile(path, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	// settings after the directive still belong to the block it was found in
+	if len(p.cfg.blocks) != blocks {
+		p.cfg.blocks = append(p.cfg.blocks, *p.block)
+		p.block = &sshConfigBlock{patterns: patterns}
+		p.ignore = false
+	}
+	return nil
+}
+
+// parseFile parses the config file at path
+func (p *sshConfigParser) parseFile(path string, depth int) error {
+	f, err := os.Open(path) // #nosec
+	if err != nil {
+		return errors.Wrap(err, "problem opening ssh config")
+	}
+	defer f.Close() // nolint
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "problem opening ssh config")
+	}
+	p.files[path] = fileStamps{modTime: info.ModTime(), size: info.Size()}
+	return errors.Wrapf(p.parse(f, depth), "problem parsing %s", path)
+}
+
+// sshConfigFile is a parsed config file along with the files it was read from
+type sshConfigFile struct {
+	cfg   *sshConfig
+	files map[string]fileStamps
+}
+
+// changed returns if any of the files changed since they were parsed
+func (c *sshConfigFile) changed() bool {
+	for path, stamps := range c.files {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Equal(stamps.modTime) || info.Size() != stamps.size {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// sshConfigFiles caches the parsed config files by path, guarded by sshConfigMux
+	sshConfigFiles = make(map[string]*sshConfigFile)
+	sshConfigMux   sync.Mutex
+)
+
+// readSSHConfig parses the OpenSSH client config file at path, "~" is expanded. Files
+// are only parsed again if they, or the files they include, change
+func readSSHConfig(path string) (*sshConfig, error) {
+	path = expandHome(path)
+	sshConfigMux.Lock()
+	defer sshConfigMux.Unlock()
+	if c, ok := sshConfigFiles[path]; ok && !c.changed() {
+		return c.cfg, nil
+	}
+	p := newSSHConfigParser()
+	if err := p.parseFile(path, 0); err != nil {
+		return nil, err
+	}
+	cfg := p.finish()
+	sshConfigFiles[path] = &sshConfigFile{cfg: cfg, files: p.files}
+	return cfg, nil
+}
+
+// expandHome replaces a leading "~" with the home directory of the user
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// matchPattern returns if the hostname matches an OpenSSH pattern where "*" matches
+// any number of characters and "?" exactly one. Like hostnames, it's case insensitive
+func matchPattern(pattern, hostname string) bool {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.Replace(re, `\*`, ".*", -1)
+	re = strings.Replace(re, `\?`, ".", -1)
+	matched, err := regexp.MatchString("(?i)^"+re+"$", hostname)
+	return err == nil && matched
+}
+
+// matches returns if the block applies to the hostname. A block matches if any of its
+// patterns matches and none of the negated ones, i.e. "!bastion", does
+func (b sshConfigBlock) matches(hostname string) bool {
+	matched := false
+	for _, p := range b.patterns {
+		if strings.HasPrefix(p, "!") {
+			if matchPattern(p[1:], hostname) {
+				return false
+			}
+			continue
+		}
+		if matchPattern(p, hostname) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// lookup returns the settings for the hostname. Like OpenSSH does, the first value
+// found for each setting is the one used, except for IdentityFile which accumulates
+func (c *sshConfig) lookup(hostname string) (sshConfigHost, error) {
+	res := sshConfigHost{}
+	for _, b := range c.blocks {
+		if !b.matches(hostname) {
+			continue
+		}
+		for _, s := range b.settings {
+			keyword, value := s[0], s[1]
+			switch keyword {
+			case "hostname":
+				if res.hostname == "" {
+					res.hostname = strings.Replace(value, "%h", hostname, -1)
+				}
+			case "user":
+				if res.user == "" {
+					res.user = value
+				}
+			case "port":
+				if res.port == 0 {
+					port, err := strconv.ParseUint(value, 10, 16)
+					if err != nil {
+						return res, errors.Errorf("invalid port '%s' for %s", value, hostname)
+					}
+					res.port = uint16(port)
+				}
+			case "identityfile":
+				res.identityFiles = append(res.identityFiles, expandHome(strings.Replace(value, "%h", hostname, -1)))
+			case "proxyjump":
+				if res.proxyJump == "" {
+					res.proxyJump = value
+				}
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,271 @@
+package connection
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const testSSHConfig = `
+# global settings
+User global
+
+Host bastion
+    HostName bastion.example.com
+    Port 2222
+
+Host *.lab !switch.lab
+    User lab
+    IdentityFile ~/.ssh/lab
+    ProxyJump bastion
+
+Host router? switch.lab
+    hostname=%h.example.com
+    IdentityFile "/keys/%h"
+
+Match host *
+    User ignored
+
+Host *
+    Port 22
+    IdentityFile ~/.ssh/id_rsa
+`
+
+func TestSSHConfigLookup(t *testing.T) {
+	home := os.Getenv("HOME")
+	if err := os.Setenv("HOME", "/home/gornir"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("HOME", home) // nolint
+	cfg, err := parseSSHConfig(strings.NewReader(testSSHConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		hostname string
+		expected sshConfigHost
+	}{
+		{
+			hostname: "bastion",
+			expected: sshConfigHost{hostname: "bastion.example.com", user: "global", port: 2222, identityFiles: []string{"/home/gornir/.ssh/id_rsa"}},
+		},
+		{
+			hostname: "router.lab",
+			expected: sshConfigHost{user: "global", port: 22, identityFiles: []string{"/home/gornir/.ssh/lab", "/home/gornir/.ssh/id_rsa"}, proxyJump: "bastion"},
+		},
+		{
+			hostname: "switch.lab",
+			expected: sshConfigHost{hostname: "switch.lab.example.com", user: "global", port: 22, identityFiles: []string{"/keys/switch.lab", "/home/gornir/.ssh/id_rsa"}},
+		},
+		{
+			hostname: "router1",
+			expected: sshConfigHost{hostname: "router1.example.com", user: "global", port: 22, identityFiles: []string{"/keys/router1", "/home/gornir/.ssh/id_rsa"}},
+		},
+		{
+			hostname: "Router2",
+			expected: sshConfigHost{hostname: "Router2.example.com", user: "global", port: 22, identityFiles: []string{"/keys/Router2", "/home/gornir/.ssh/id_rsa"}},
+		},
+		{
+			hostname: "router10",
+			expected: sshConfigHost{user: "global", port: 22, identityFiles: []string{"/home/gornir/.ssh/id_rsa"}},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.hostname, func(t *testing.T) {
+			got, err := cfg.lookup(tc.hostname)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got %+v, want %+v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSSHConfigInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gornir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	home := os.Getenv("HOME")
+	if err := os.Setenv("HOME", dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("HOME", home) // nolint
+
+	files := map[string]string{
+		"config":               "Host router\n    Include config.d/*.conf\n    User admin\n\nInclude " + filepath.Join(dir, "global") + "\n",
+		"global":               "Host *\n    Port 2222\n",
+		".ssh/config.d/a.conf": "HostName router.example.com\n\nHost switch\n    User switch\n",
+		".ssh/config.d/b.conf": "Include config.d/b.conf\n",
+	}
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range files {
+		write(name, content)
+	}
+
+	_, err = readSSHConfig(filepath.Join(dir, "config"))
+	if err == nil || !strings.Contains(err.Error(), "too many nested includes") {
+		t.Errorf("got error %v, want one about nested includes", err)
+	}
+
+	write(".ssh/config.d/b.conf", "# nothing\n")
+	cfg, err := readSSHConfig(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]sshConfigHost{
+		"router": {hostname: "router.example.com", user: "admin", port: 2222},
+		"switch": {user: "switch", port: 2222},
+	}
+	for hostname, want := range expected {
+		got, err := cfg.lookup(hostname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", hostname, got, want)
+		}
+	}
+
+	// files are only parsed again if any of them changes
+	if cached, err := readSSHConfig(filepath.Join(dir, "config")); err != nil || cached != cfg {
+		t.Errorf("got %p, %v, want the cached config %p", cached, err, cfg)
+	}
+	write("global", "Host *\n    Port 22\n")
+	cfg, err = readSSHConfig(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := cfg.lookup("router"); err != nil || got.port != 22 {
+		t.Errorf("got %+v, %v, want port 22", got, err)
+	}
+}
+
+func TestSSHConfigErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"missing argument", "Host a\n  User\n", "line 2: missing argument for 'User'"},
+		{"wrong port", "Host a\n  Port abc\n", "invalid port 'abc' for a"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := parseSSHConfig(strings.NewReader(tc.config))
+			if err == nil {
+				_, err = cfg.lookup("a")
+			}
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("got error %v, want %s", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestSSHOpenWithSSHConfig(t *testing.T) {
+	bastion := newTestServer(t)
+	defer bastion.close()
+	target := newTestServer(t)
+	defer target.close()
+
+	dir, err := ioutil.TempDir("", "gornir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ssh.MarshalPrivateKey(target.userKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_ecdsa")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(key), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	bastionAddr := bastion.listener.Addr().(*net.TCPAddr)
+	targetAddr := target.listener.Addr().(*net.TCPAddr)
+	config := fmt.Sprintf(`
+Host bastion
+    HostName %s
+    Port %d
+    User gornir
+
+Host device
+    HostName %s
+    Port %d
+    User gornir
+    IdentityFile %s
+    IdentityFile %s
+    ProxyJump bastion
+`, bastionAddr.IP, bastionAddr.Port, targetAddr.IP, targetAddr.Port, filepath.Join(dir, "missing"), keyFile)
+	configFile := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		host *gornir.Host
+		err  string
+	}{
+		{
+			name: "settings from the config",
+			host: &gornir.Host{Hostname: "device", Password: "secret"},
+		},
+		{
+			name: "host fields win",
+			host: &gornir.Host{Hostname: "device", Password: "secret", Username: "admin"},
+			err:  "unable to authenticate",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			open := &SSHOpen{SSHConfigFile: configFile, Auth: &Auth{Methods: []string{AuthPublicKey, AuthPassword}}, JumpAuth: &JumpHostAuth{Password: "secret"}}
+			conn, err := open.Open(context.Background(), tc.host)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("got error %v, want one containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Close(context.Background()) // nolint
+			if logins, _ := bastion.connections(); logins != 1 {
+				t.Errorf("bastion: got %d logins, want 1", logins)
+			}
+			if target.authMethod() != AuthPublicKey {
+				t.Errorf("authenticated with %s, want %s", target.authMethod(), AuthPublicKey)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package inventory
 
 import (
+	"fmt"
 	"io/ioutil"
+	"sort"
+	"strings"
 
 	"github.com/nornir-automation/gornir/pkg/gornir"
 
@@ -11,7 +14,9 @@ import (
 
 // FromYAML satisfies the InventoryPlugin interface for YAML files.
 type FromYAML struct {
-	HostsFile string
+	HostsFile    string // File with the hosts
+	GroupsFile   string // File with the groups (optional)
+	DefaultsFile string // File with the defaults (optional)
 }
 
 // Create parses the content of a YAML file following the same structure
@@ -27,6 +32,30 @@ type FromYAML struct {
 //         hostname: dev2.group_1
 //         username: root
 //         password: docker
+//
+// Optionally, groups and defaults can be read from their own files, following
+// the same format nornir's SimpleInventory uses. For instance, hosts.yaml:
+//     dev1.group_1:
+//         hostname: dev1.group_1
+//         groups:
+//             - group_1
+//
+// groups.yaml:
+//     group_1:
+//         data:
+//             site: site_1
+//         connection_options:
+//             netconf:
+//                 port: 830
+//
+// defaults.yaml:
+//     port: 22
+//     username: root
+//     password: docker
+//
+// Entries without parameters, i.e. "group_2:", are valid and inherit everything.
+// References to groups that don't exist are reported along with the file and the
+// line where they were found
 func (f FromYAML) Create() (gornir.Inventory, error) {
 	b, err := ioutil.ReadFile(f.HostsFile)
 	if err != nil {
@@ -38,7 +67,147 @@ func (f FromYAML) Create() (gornir.Inventory, error) {
 		return gornir.Inventory{}, errors.Wrap(err, "problem unmarshalling yaml")
 	}
 
-	return gornir.Inventory{
-		Hosts: hosts,
-	}, nil
+	groups := make(map[string]*gornir.Group)
+	var gb []byte
+	if f.GroupsFile != "" {
+		gb, err = ioutil.ReadFile(f.GroupsFile)
+		if err != nil {
+			return gornir.Inventory{}, errors.Wrap(err, "problem reading groups file")
+		}
+		if err = yaml.Unmarshal(gb, groups); err != nil {
+			return gornir.Inventory{}, errors.Wrap(err, "problem unmarshalling groups yaml")
+		}
+	}
+
+	var defaults *gornir.Defaults
+	if f.DefaultsFile != "" {
+		db, err := ioutil.ReadFile(f.DefaultsFile)
+		if err != nil {
+			return gornir.Inventory{}, errors.Wrap(err, "problem reading defaults file")
+		}
+		defaults = &gornir.Defaults{}
+		if err = yaml.Unmarshal(db, defaults); err != nil {
+			return gornir.Inventory{}, errors.Wrap(err, "problem unmarshalling defaults yaml")
+		}
+	}
+
+	// we sort the names so errors are reported consistently
+	groupNames := make([]string, 0, len(groups))
+	for name := range groups {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+	for _, name := range groupNames {
+		// entries without a body are unmarshalled as nil
+		if groups[name] == nil {
+			groups[name] = &gornir.Group{}
+		}
+		if err := checkGroups(f.GroupsFile, gb, "group", name, groups[name].Groups, groups); err != nil {
+			return gornir.Inventory{}, err
+		}
+	}
+	hostNames := make([]string, 0, len(hosts))
+	for name := range hosts {
+		hostNames = append(hostNames, name)
+	}
+	sort.Strings(hostNames)
+	for _, name := range hostNames {
+		if hosts[name] == nil {
+			hosts[name] = &gornir.Host{}
+		}
+		if err := checkGroups(f.HostsFile, b, "host", name, hosts[name].Groups, groups); err != nil {
+			return gornir.Inventory{}, err
+		}
+	}
+
+	inv := gornir.Inventory{
+		Hosts:    hosts,
+		Groups:   groups,
+		Defaults: defaults,
+	}
+	if err := inv.Link(); err != nil {
+		return gornir.Inventory{}, errors.Wrap(err, "problem linking inventory")
+	}
+	return inv, nil
+}
+
+// checkGroups returns an error pointing to the file, with content b, and the line where a
+// reference to an unknown group is made
+func checkGroups(file string, b []byte, kind, name string, refs []string, groups map[string]*gornir.Group) error {
+	for _, ref := range refs {
+		if _, ok := groups[ref]; !ok {
+			if line := groupLine(b, name, ref); line > 0 {
+				file = fmt.Sprintf("%s:%d", file, line)
+			}
+			return errors.Errorf("%s: %s '%s' belongs to unknown group '%s'", file, kind, name, ref)
+		}
+	}
+	return nil
+}
+
+// groupLine returns the line where the entry name references the group ref, or the line of
+// the entry if the reference can't be found, by scanning the content b as yaml.v2 doesn't
+// keep track of where the values come from. It returns 0 if the entry can't be found either
+func groupLine(b []byte, name, ref string) int {
+	entry := 0   // line of the entry
+	indent := -1 // indentation of the fields of the entry
+	groups := -1 // indentation of the groups field while reading it
+	for i, line := range strings.Split(string(b), "\n") {
+		if c := strings.Index(line, " #"); c >= 0 {
+			line = line[:c]
+		}
+		content := strings.TrimSpace(line)
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		lineIndent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if lineIndent == 0 {
+			if entry > 0 {
+				break
+			}
+			if key, _ := splitKey(content); key == name {
+				entry = i + 1
+			}
+			continue
+		}
+		if entry == 0 {
+			continue
+		}
+		if indent < 0 {
+			indent = lineIndent
+		}
+		switch key, value := splitKey(content); {
+		case lineIndent == indent && key == "groups":
+			groups = lineIndent
+			if hasGroup(strings.Trim(value, "[]"), ref) {
+				return i + 1
+			}
+		case groups >= 0 && lineIndent >= groups && strings.HasPrefix(content, "-"):
+			if hasGroup(content[1:], ref) {
+				return i + 1
+			}
+		case lineIndent <= indent:
+			groups = -1
+		}
+	}
+	return entry
+}
+
+// splitKey returns the key and the value of a "key: value" line, without quotes around the key
+func splitKey(content string) (string, string) {
+	i := strings.Index(content, ":")
+	if i < 0 {
+		return "", ""
+	}
+	return strings.Trim(strings.TrimSpace(content[:i]), `"'`), strings.TrimSpace(content[i+1:])
+}
+
+// hasGroup returns whether the comma separated list of groups contains ref
+func hasGroup(list, ref string) bool {
+	for _, group := range strings.Split(list, ",") {
+		if strings.Trim(strings.TrimSpace(group), `"'`) == ref {
+			return true
+		}
+	}
+	return false
 }
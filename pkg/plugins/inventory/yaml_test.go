@@ -1,9 +1,12 @@
 package inventory_test
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/nornir-automation/gornir/pkg/plugins/inventory"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 var (
@@ -49,3 +52,150 @@ func BenchmarkCreate(b *testing.B) {
 		// _ = gornir.New().WithInventory(inv)
 	}
 }
+
+func TestCreateWithGroups(t *testing.T) {
+	plugin := inventory.FromYAML{
+		HostsFile:    "testdata/groups/hosts.yaml",
+		GroupsFile:   "testdata/groups/groups.yaml",
+		DefaultsFile: "testdata/groups/defaults.yaml",
+	}
+	inv, err := plugin.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		host     string
+		username string
+		password string
+		platform string
+		port     uint16
+		netconf  string // username and port used for the netconf connection
+		data     map[string]interface{}
+	}{
+		{
+			host:     "dev1.group_1",
+			username: "root",
+			password: "docker",
+			platform: "linux",
+			port:     22,
+			netconf:  "root:22",
+			data:     map[string]interface{}{"role": "leaf", "site": "site_1", "ntp": "10.0.0.1"},
+		},
+		{
+			host:     "dev2.group_1",
+			username: "root",
+			password: "secret",
+			platform: "linux",
+			port:     22,
+			netconf:  "root:22",
+			data:     map[string]interface{}{"role": "leaf", "site": "site_1", "ntp": "10.0.0.1"},
+		},
+		{
+			host:     "dev3.group_2",
+			username: "admin",
+			password: "docker",
+			platform: "ios",
+			port:     22,
+			netconf:  "netconf:830",
+			data:     map[string]interface{}{"role": "spine", "site": "site_1", "ntp": "10.0.0.1"},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.host, func(t *testing.T) {
+			host := inv.Hosts[tc.host]
+			if host.GetUsername() != tc.username {
+				t.Errorf("username: got %s, want %s", host.GetUsername(), tc.username)
+			}
+			if host.GetPassword() != tc.password {
+				t.Errorf("password: got %s, want %s", host.GetPassword(), tc.password)
+			}
+			if host.GetPlatform() != tc.platform {
+				t.Errorf("platform: got %s, want %s", host.GetPlatform(), tc.platform)
+			}
+			if host.GetPort() != tc.port {
+				t.Errorf("port: got %d, want %d", host.GetPort(), tc.port)
+			}
+			netconf := host.GetConnectionOptions("netconf")
+			if got := fmt.Sprintf("%s:%d", netconf.Username, netconf.Port); got != tc.netconf {
+				t.Errorf("netconf: got %s, want %s", got, tc.netconf)
+			}
+			if !cmp.Equal(host.AllData(), tc.data) {
+				t.Error(cmp.Diff(host.AllData(), tc.data))
+			}
+		})
+	}
+}
+
+func TestCreateUnknownGroups(t *testing.T) {
+	tt := []struct {
+		name   string
+		plugin inventory.FromYAML
+		err    string
+	}{
+		{
+			name: "host with unknown group",
+			plugin: inventory.FromYAML{
+				HostsFile:  "testdata/groups/unknown_hosts.yaml",
+				GroupsFile: "testdata/groups/groups.yaml",
+			},
+			err: "testdata/groups/unknown_hosts.yaml:11: host 'dev2.group_1' belongs to unknown group 'group_3'",
+		},
+		{
+			name: "group with unknown group",
+			plugin: inventory.FromYAML{
+				HostsFile:  "testdata/groups/hosts.yaml",
+				GroupsFile: "testdata/groups/unknown_groups.yaml",
+			},
+			err: "testdata/groups/unknown_groups.yaml:4: group 'group_1' belongs to unknown group 'site_2'",
+		},
+		{
+			name: "no groups file",
+			plugin: inventory.FromYAML{
+				HostsFile: "testdata/groups/hosts.yaml",
+			},
+			err: "testdata/groups/hosts.yaml:5: host 'dev1.group_1' belongs to unknown group 'group_1'",
+		},
+		{
+			name: "unknown group in a flow sequence",
+			plugin: inventory.FromYAML{
+				HostsFile:  "testdata/groups/unknown_flow_hosts.yaml",
+				GroupsFile: "testdata/groups/groups.yaml",
+			},
+			err: "testdata/groups/unknown_flow_hosts.yaml:7: host 'dev1.group_1' belongs to unknown group 'group_3'",
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.plugin.Create()
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Error() != tc.err {
+				t.Errorf("got '%v', want '%s'", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestCreateEmptyEntries(t *testing.T) {
+	plugin := inventory.FromYAML{
+		HostsFile:  "testdata/groups/empty_hosts.yaml",
+		GroupsFile: "testdata/groups/empty_groups.yaml",
+	}
+	inv, err := plugin.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Hosts) != 2 || inv.Hosts["dev2.group_1"] == nil {
+		t.Fatalf("got hosts %v, want dev1.group_1 and dev2.group_1", inv.Hosts)
+	}
+	if inv.Groups["group_2"] == nil {
+		t.Fatal("empty group wasn't created")
+	}
+	if site, _ := inv.Hosts["dev1.group_1"].GetData("site"); site != "site_1" {
+		t.Errorf("got site %v, want site_1", site)
+	}
+}
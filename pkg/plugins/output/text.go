@@ -3,6 +3,7 @@ package output
 import (
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/nornir-automation/gornir/pkg/gornir"
 )
@@ -69,18 +70,56 @@ func renderResult(wr io.Writer, result *gornir.JobResult, renderHost bool, color
 		}
 	}
 	if result.Err() != nil {
-		if _, err := wr.Write([]byte(fmt.Sprintf("  - err: %v\n\n", result.Err()))); err != nil {
+		if _, err := wr.Write([]byte(fmt.Sprintf("  - err: %v\n", result.Err()))); err != nil {
+			return err
+		}
+		if err := RenderSubResults(wr, result, 1, color); err != nil {
+			return err
+		}
+		if _, err := wr.Write([]byte("\n")); err != nil {
 			return err
 		}
 	} else {
 		if _, err := wr.Write([]byte(fmt.Sprintf("%s\n", result.Data()))); err != nil {
 			return err
 		}
+		if err := RenderSubResults(wr, result, 1, color); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// RenderSubResults writes the results of the subtasks of the JobResult as a tree, indenting
+// them according to their depth, starting at the given one, in either color or b/w
+func RenderSubResults(wr io.Writer, result *gornir.JobResult, depth int, color bool) error {
+	indent := strings.Repeat("  ", depth)
+	for _, sub := range result.SubResults() {
+		colorFunc := green
+		body := fmt.Sprintf("%v", sub.Data())
+		if sub.Err() != nil {
+			colorFunc = red
+			body = fmt.Sprintf("  - err: %v", sub.Err())
+		}
+		if _, err := wr.Write([]byte(indent + colorFunc(fmt.Sprintf("> %s\n", sub.Name()), color))); err != nil {
+			return err
+		}
+		for _, line := range strings.Split(body, "\n") {
+			if line != "" {
+				line = indent + line
+			}
+			if _, err := wr.Write([]byte(line + "\n")); err != nil {
+				return err
+			}
+		}
+		if err := RenderSubResults(wr, sub, depth+1, color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // RenderResults writes the contents of the results to an io.Writer in either color or b/w. The
 // output will be similar to:
 //     # What's my ip?
@@ -0,0 +1,131 @@
+// Package platform implements a registry of drivers that describe how to interact
+// with the CLI of each platform, i.e. "ios" or "junos". Tasks pick the driver
+// matching the platform of the host, see ForHost
+package platform
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/connection"
+
+	"github.com/pkg/errors"
+)
+
+// Driver describes the CLI of a platform
+type Driver struct {
+	Name           string   // Name of the platform, as set in Host.Platform
+	Interactive    bool     // Commands can only be run in an interactive shell, see task.RemoteCommand
+	Prompt         string   // Regular expression matching the prompt, which must be the last line of the output
+	DisablePaging  []string // Commands to disable paging
+	ConfigMode     []string // Commands to enter configuration mode
+	ExitConfigMode []string // Commands to exit configuration mode
+	AbortConfig    []string // Commands to discard the changes, if possible, and exit configuration mode after an error
+	Save           []string // Commands to save the running configuration, if the platform needs them
+	ConfigErrors   []string // Regular expressions matching the output of rejected configuration commands
+}
+
+// ShellOptions returns the connection.ShellOptions to open a shell on the platform
+func (d Driver) ShellOptions() connection.ShellOptions {
+	return connection.ShellOptions{
+		Prompt:         d.Prompt,
+		DisablePaging:  d.DisablePaging,
+		ConfigMode:     d.ConfigMode,
+		ExitConfigMode: d.ExitConfigMode,
+		AbortConfig:    d.AbortConfig,
+		SaveConfig:     d.Save,
+		ConfigErrors:   d.ConfigErrors,
+	}
+}
+
+var (
+	drivers    = make(map[string]Driver)
+	driversMux = &sync.RWMutex{}
+)
+
+// Register registers the driver under its name. Registering a driver
+// with a name that already exists replaces the existing one
+func Register(d Driver) {
+	driversMux.Lock()
+	defer driversMux.Unlock()
+	drivers[d.Name] = d
+}
+
+// Get returns the driver registered for the platform
+func Get(name string) (Driver, error) {
+	if name == "" {
+		return Driver{}, errors.New("platform not set")
+	}
+	driversMux.RLock()
+	defer driversMux.RUnlock()
+	d, ok := drivers[name]
+	if !ok {
+		return Driver{}, errors.Errorf("unknown platform '%s', registered platforms are %v", name, names())
+	}
+	return d, nil
+}
+
+// ForHost returns the driver for the platform of the "ssh" connection of the host,
+// which defaults to Host.Platform, see Host.GetConnectionOptions
+func ForHost(host *gornir.Host) (Driver, error) {
+	d, err := Get(host.GetConnectionOptions("ssh").Platform)
+	return d, errors.Wrapf(err, "problem finding driver for %s", host.Hostname)
+}
+
+// names returns the sorted names of the registered drivers, driversMux must be held
+func names() []string {
+	res := make([]string, 0, len(drivers))
+	for name := range drivers {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// ciscoPrompt matches the prompts of IOS-like CLIs, i.e. "router>", "router#" or "router(config-if)#"
+const ciscoPrompt = `[\w.-]+(\(config[\w.-]*\))?[>#]\s?$`
+
+// ciscoConfigErrors match the errors IOS-like CLIs print when they reject a command
+var ciscoConfigErrors = []string{`% Invalid input.*`, `% Incomplete command.*`, `% Ambiguous command.*`}
+
+func init() {
+	Register(Driver{
+		Name:   "linux",
+		Prompt: `[\w.@:~/-]+[$#]\s?$`,
+	})
+	Register(Driver{
+		Name:           "ios",
+		Interactive:    true,
+		Prompt:         ciscoPrompt,
+		DisablePaging:  []string{"terminal length 0"},
+		ConfigMode:     []string{"configure terminal"},
+		ExitConfigMode: []string{"end"},
+		AbortConfig:    []string{"end"},
+		Save:           []string{"write memory"},
+		ConfigErrors:   ciscoConfigErrors,
+	})
+	Register(Driver{
+		Name:           "eos",
+		Interactive:    true,
+		Prompt:         ciscoPrompt,
+		DisablePaging:  []string{"terminal length 0"},
+		ConfigMode:     []string{"configure"},
+		ExitConfigMode: []string{"end"},
+		AbortConfig:    []string{"end"},
+		Save:           []string{"copy running-config startup-config"},
+		ConfigErrors:   ciscoConfigErrors,
+	})
+	Register(Driver{
+		Name:          "junos",
+		Interactive:   true,
+		Prompt:        `(\[edit[^\]]*\]\s+)?[\w.-]+@[\w.-]+[>#%]\s?$`,
+		DisablePaging: []string{"set cli screen-length 0"},
+		// a private candidate configuration so changes made by other users are not committed
+		ConfigMode:   []string{"configure private"},
+		ConfigErrors: []string{`(?m)^\s*(syntax error|unknown command|error:).*`},
+		// changes are only applied, and saved, when committed
+		ExitConfigMode: []string{"commit and-quit"},
+		AbortConfig:    []string{"rollback 0", "exit configuration-mode"},
+	})
+}
@@ -0,0 +1,71 @@
+package platform_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/platform"
+)
+
+func TestForHost(t *testing.T) {
+	platform.Register(platform.Driver{Name: "test", Prompt: "test#$"})
+
+	testCases := []struct {
+		name     string
+		host     *gornir.Host
+		expected string
+		err      string
+	}{
+		{
+			name:     "builtin",
+			host:     &gornir.Host{Hostname: "router", Platform: "ios"},
+			expected: "ios",
+		},
+		{
+			name:     "registered",
+			host:     &gornir.Host{Hostname: "router", Platform: "test"},
+			expected: "test",
+		},
+		{
+			name: "platform of the connection",
+			host: &gornir.Host{
+				Hostname:          "router",
+				Platform:          "linux",
+				ConnectionOptions: map[string]gornir.ConnectionOptions{"ssh": {Platform: "junos"}},
+			},
+			expected: "junos",
+		},
+		{
+			name: "unknown",
+			host: &gornir.Host{Hostname: "router", Platform: "nxos"},
+			err:  "problem finding driver for router: unknown platform 'nxos', registered platforms are [eos ios junos linux test]",
+		},
+		{
+			name: "not set",
+			host: &gornir.Host{Hostname: "router"},
+			err:  "problem finding driver for router: platform not set",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := platform.ForHost(tc.host)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Errorf("got error %v, want %s", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Name != tc.expected {
+				t.Errorf("got driver %s, want %s", d.Name, tc.expected)
+			}
+			if strings.TrimSpace(d.ShellOptions().Prompt) == "" {
+				t.Error("driver without prompt")
+			}
+		})
+	}
+}
@@ -4,17 +4,18 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"reflect"
 	"sync"
 
 	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/output"
 )
 
 const (
-	redColor   = "\u001b[31m"
-	greenColor = "\u001b[32m"
-	blueColor  = "\u001b[34m"
-	resetColor = "\u001b[0m"
+	redColor    = "\u001b[31m"
+	greenColor  = "\u001b[32m"
+	yellowColor = "\u001b[33m"
+	blueColor   = "\u001b[34m"
+	resetColor  = "\u001b[0m"
 )
 
 func red(m string, color bool) string {
@@ -31,6 +32,13 @@ func green(m string, color bool) string {
 	return m
 }
 
+func yellow(m string, color bool) string {
+	if color {
+		return fmt.Sprintf("%v%v%v", yellowColor, m, resetColor)
+	}
+	return m
+}
+
 func blue(m string, color bool) string {
 	if color {
 		return fmt.Sprintf("%v%v%v", blueColor, m, resetColor)
@@ -56,22 +64,7 @@ func Render(wr io.Writer, color bool) *RenderProcessor {
 
 // TaskStarted renders task.Metdata().Identifier or the task's struct's name
 func (r *RenderProcessor) TaskStarted(ctx context.Context, logger gornir.Logger, task gornir.Task) error {
-	var taskName string
-
-	meta := task.Metadata()
-	if meta != nil {
-		taskName = meta.Identifier
-	}
-
-	if taskName == "" {
-		if t := reflect.TypeOf(task); t.Kind() == reflect.Ptr {
-			taskName = t.Elem().Name()
-		} else {
-			taskName = t.Name()
-		}
-	}
-
-	_, err := r.wr.Write([]byte(blue(fmt.Sprintf("# %s\n", taskName), r.color)))
+	_, err := r.wr.Write([]byte(blue(fmt.Sprintf("# %s\n", gornir.TaskName(task)), r.color)))
 	return err
 }
 
@@ -85,7 +78,8 @@ func (r *RenderProcessor) TaskInstanceStarted(ctx context.Context, logger gornir
 	return nil
 }
 
-// TaskInstanceCompleted renders either the result or the error resulted in the execution of the TaskInstance
+// TaskInstanceCompleted renders either the result or the error resulted in the execution of the TaskInstance.
+// Results of subtasks are rendered as a tree below the result of the TaskInstance
 func (r *RenderProcessor) TaskInstanceCompleted(ctx context.Context, logger gornir.Logger, jobResult *gornir.JobResult, host *gornir.Host, task gornir.Task) error {
 	r.mux.Lock()
 	defer r.mux.Unlock()
@@ -95,16 +89,42 @@ func (r *RenderProcessor) TaskInstanceCompleted(ctx context.Context, logger gorn
 		if _, err := r.wr.Write([]byte(green(fmt.Sprintf("@ %s\n", host.Hostname), r.color))); err != nil {
 			return err
 		}
-		if _, err := r.wr.Write([]byte(fmt.Sprintf("%v\n\n", jobResult.Data()))); err != nil {
+		if _, err := r.wr.Write([]byte(fmt.Sprintf("%v\n", jobResult.Data()))); err != nil {
 			return err
 		}
 	default:
 		if _, err := r.wr.Write([]byte(red(fmt.Sprintf("@ %s\n", host.Hostname), r.color))); err != nil {
 			return err
 		}
-		if _, err := r.wr.Write([]byte(fmt.Sprintf("  - err: %v\n\n", jobResult.Err()))); err != nil {
+		if _, err := r.wr.Write([]byte(fmt.Sprintf("  - err: %v\n", jobResult.Err()))); err != nil {
 			return err
 		}
 	}
-	return nil
+	if err := output.RenderSubResults(r.wr, jobResult, 1, r.color); err != nil {
+		return err
+	}
+	_, err := r.wr.Write([]byte("\n"))
+	return err
+}
+
+// TaskInstanceRetry renders the error of the failed attempt before the TaskInstance is retried
+func (r *RenderProcessor) TaskInstanceRetry(ctx context.Context, logger gornir.Logger, host *gornir.Host, task gornir.Task, attempt int, err error) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if _, err := r.wr.Write([]byte(yellow(fmt.Sprintf("@ %s\n", host.Hostname), r.color))); err != nil {
+		return err
+	}
+	_, werr := r.wr.Write([]byte(fmt.Sprintf("  - attempt %d failed, retrying: %v\n\n", attempt, err)))
+	return werr
+}
+
+// TaskInstanceOutput renders the output of the TaskInstance as it's produced,
+// each line prefixed with the name of the host and the stream
+func (r *RenderProcessor) TaskInstanceOutput(ctx context.Context, logger gornir.Logger, host *gornir.Host, task gornir.Task, stream, line string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	_, err := r.wr.Write([]byte(fmt.Sprintf("%s %s\n", blue(fmt.Sprintf("%s (%s) |", host.Hostname, stream), r.color), line)))
+	return err
 }
@@ -58,12 +58,74 @@ func (t *dummyTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.
 	return dummyTaskResult{}, nil
 }
 
+// dummyParentTask runs dummyTask twice as subtask, the second one nested in a dummyTask
+type dummyParentTask struct {
+}
+
+func (t *dummyParentTask) Metadata() *gornir.TaskMetadata {
+	return nil
+}
+
+type dummyParentTaskResult struct {
+}
+
+func (r dummyParentTaskResult) String() string {
+	return "  - all done!"
+}
+
+func (t *dummyParentTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	if _, err := gornir.RunSubtask(ctx, logger, host, &dummyTask{}); err != nil {
+		return dummyParentTaskResult{}, err
+	}
+	nested := &dummyNestingTask{meta: &gornir.TaskMetadata{Identifier: "nested"}}
+	if _, err := gornir.RunSubtask(ctx, logger, host, nested); err != nil {
+		return dummyParentTaskResult{}, err
+	}
+	return dummyParentTaskResult{}, nil
+}
+
+// dummyNestingTask runs dummyTask as a subtask
+type dummyNestingTask struct {
+	meta *gornir.TaskMetadata
+}
+
+func (t *dummyNestingTask) Metadata() *gornir.TaskMetadata {
+	return t.meta
+}
+
+func (t *dummyNestingTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	return gornir.RunSubtask(ctx, logger, host, &dummyTask{})
+}
+
+// dummyStreamingTask writes its output as it runs
+type dummyStreamingTask struct {
+}
+
+func (t *dummyStreamingTask) Metadata() *gornir.TaskMetadata {
+	return nil
+}
+
+func (t *dummyStreamingTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	w := gornir.OutputWriter(ctx, logger, host, "stdout")
+	if _, err := w.Write([]byte("downloading image\ninstalling")); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write([]byte(" image\nrebooting")); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return dummyTaskResult{}, nil
+}
+
 func TestRender(t *testing.T) {
 	cases := []struct {
 		name       string
 		goldenPath string
 		task       gornir.Task
 		color      bool
+		retry      *gornir.RetryPolicy
 	}{
 		{
 			name:       "color_task_no_name",
@@ -85,6 +147,37 @@ func TestRender(t *testing.T) {
 			},
 			color: true,
 		},
+		{
+			name:       "no_color_task_retry",
+			goldenPath: filepath.Join("testdata", "render", "no_color_task_retry.golden"),
+			task:       &dummyTask{},
+			color:      false,
+			retry:      &gornir.RetryPolicy{Attempts: 2},
+		},
+		{
+			name:       "color_task_with_subtasks",
+			goldenPath: filepath.Join("testdata", "render", "color_task_with_subtasks.golden"),
+			task:       &dummyParentTask{},
+			color:      true,
+		},
+		{
+			name:       "no_color_task_with_subtasks",
+			goldenPath: filepath.Join("testdata", "render", "no_color_task_with_subtasks.golden"),
+			task:       &dummyParentTask{},
+			color:      false,
+		},
+		{
+			name:       "color_task_streaming",
+			goldenPath: filepath.Join("testdata", "render", "color_task_streaming.golden"),
+			task:       &dummyStreamingTask{},
+			color:      true,
+		},
+		{
+			name:       "no_color_task_streaming",
+			goldenPath: filepath.Join("testdata", "render", "no_color_task_streaming.golden"),
+			task:       &dummyStreamingTask{},
+			color:      false,
+		},
 	}
 
 	for _, tc := range cases {
@@ -99,6 +192,9 @@ func TestRender(t *testing.T) {
 			log := logger.NewLogrus(false)
 			rnr := runner.Sorted()
 			gr := gornir.New().WithInventory(inv).WithLogger(log).WithRunner(rnr)
+			if tc.retry != nil {
+				gr = gr.WithRetryPolicy(*tc.retry)
+			}
 
 			b := []byte{}
 			buf := bytes.NewBuffer(b)
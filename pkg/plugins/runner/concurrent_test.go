@@ -0,0 +1,90 @@
+package runner_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/runner"
+)
+
+type testConnection struct {
+}
+
+func (c *testConnection) Close(ctx context.Context) error {
+	return nil
+}
+
+// testTaskSharedState touches all the mutable state of the host
+type testTaskSharedState struct {
+}
+
+func (t *testTaskSharedState) Metadata() *gornir.TaskMetadata {
+	return nil
+}
+
+func (t *testTaskSharedState) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	host.SetConnection("test", &testConnection{})
+	if _, err := host.GetConnection("test"); err != nil {
+		return nil, err
+	}
+	host.UpdateState("counter", func(value interface{}, ok bool) interface{} {
+		if !ok {
+			return 1
+		}
+		return value.(int) + 1
+	})
+	host.SetState("last", host.Hostname)
+	if _, ok := host.GetState("last"); !ok {
+		return nil, fmt.Errorf("state wasn't stored")
+	}
+	return nil, host.Err()
+}
+
+// TestConcurrentRuns runs the same task twice concurrently over overlapping
+// inventories, it's meant to be run with -race
+func TestConcurrentRuns(t *testing.T) {
+	testHosts := map[string]*gornir.Host{
+		"dev1": {Hostname: "dev1"},
+		"dev2": {Hostname: "dev2"},
+		"dev3": {Hostname: "dev3"},
+		"dev4": {Hostname: "dev4"},
+	}
+	inv := gornir.Inventory{Hosts: testHosts}
+	subset := inv.Filter(func(h *gornir.Host) bool { return h.Hostname != "dev4" })
+
+	const iterations = 10
+	gr1 := gornir.New().WithInventory(inv).WithLogger(NewNullLogger()).WithRunner(runner.Parallel())
+	gr2 := gornir.New().WithInventory(*subset).WithLogger(NewNullLogger()).WithRunner(runner.Pool(2))
+
+	results := make(chan *gornir.JobResult, 2*iterations*len(testHosts))
+	for i := 0; i < iterations; i++ {
+		if err := gr1.RunAsync(context.Background(), &testTaskSharedState{}, results); err != nil {
+			t.Fatal(err)
+		}
+		if err := gr2.RunAsync(context.Background(), &testTaskSharedState{}, results); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := gr1.Runner.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gr2.Runner.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	close(results)
+
+	if err := gornir.Aggregate(results).RaiseOnError(); err != nil {
+		t.Fatal(err)
+	}
+	for name, host := range testHosts {
+		expected := 2 * iterations
+		if name == "dev4" {
+			expected = iterations
+		}
+		if counter, _ := host.GetState("counter"); counter != expected {
+			t.Errorf("%s: got counter %v, want %d", name, counter, expected)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+)
+
+// PoolRunner will run the task over the hosts in parallel but using a fixed
+// number of workers, limiting the amount of TaskInstances running at the same time.
+// If the context is cancelled while hosts are still queued the task won't be executed
+// on them and their result will contain the error of the context.
+type PoolRunner struct {
+	workers int
+	wg      *sync.WaitGroup
+}
+
+// Pool returns an instantiated PoolRunner that will run at most n TaskInstances
+// at the same time. If n is lower than 1 a single worker is used.
+func Pool(n int) *PoolRunner {
+	if n < 1 {
+		n = 1
+	}
+	return &PoolRunner{
+		workers: n,
+		wg:      &sync.WaitGroup{},
+	}
+}
+
+// Run implements the Run method of the gornir.Runner interface
+func (r PoolRunner) Run(ctx context.Context, logger gornir.Logger, processors gornir.Processors, task gornir.Task, hosts map[string]*gornir.Host, results chan *gornir.JobResult) error {
+	logger = logger.WithField("runner", "Pool").WithField("workers", r.workers)
+	logger.Debug("starting runner")
+
+	if len(hosts) == 0 {
+		logger.Warn("no hosts to run against")
+		return nil
+	}
+	r.wg.Add(len(hosts))
+
+	// we queue the hosts sorted so the order of execution is predictable
+	queue := make(chan string, len(hosts))
+	hostnames := make([]string, 0, len(hosts))
+	for hostname := range hosts {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+	for _, hostname := range hostnames {
+		queue <- hostname
+	}
+	close(queue)
+
+	queued := int64(len(hosts))
+	inFlight := int64(0)
+
+	workers := r.workers
+	if workers > len(hosts) {
+		workers = len(hosts)
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for hostname := range queue {
+				hostLogger := logger.WithField("host", hostname)
+				hostLogger.
+					WithField("queued", atomic.AddInt64(&queued, -1)).
+					WithField("inFlight", atomic.AddInt64(&inFlight, 1)).
+					Debug("calling function")
+				if err := gornir.TaskWrapper(ctx, hostLogger, processors, r.wg, task, hosts[hostname], results); err != nil {
+					logger.Error(fmt.Sprintf("problem calling TaskWrapper: %s", err))
+				}
+				hostLogger.
+					WithField("queued", atomic.LoadInt64(&queued)).
+					WithField("inFlight", atomic.AddInt64(&inFlight, -1)).
+					Debug("function completed")
+			}
+		}()
+	}
+	return nil
+}
+
+// Wait implements the Wait method of the gornir.Runner interface
+func (r PoolRunner) Wait() error {
+	r.wg.Wait()
+	return nil
+}
+
+// Close implements the Close method of the gornir.Runner interface
+func (r PoolRunner) Close() error {
+	return nil
+}
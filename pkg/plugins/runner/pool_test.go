@@ -0,0 +1,168 @@
+package runner_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/runner"
+)
+
+// testTaskConcurrency sleeps until the context is done, the sleepDuration has passed
+// or, if set, until wait instances are running at the same time, and keeps track of
+// how many instances were running at the same time
+type testTaskConcurrency struct {
+	sleepDuration time.Duration
+	wait          int
+	reached       chan struct{} // closed once wait instances are running
+	mux           sync.Mutex
+	running       int
+	maxRunning    int
+}
+
+func (t *testTaskConcurrency) Metadata() *gornir.TaskMetadata {
+	return nil
+}
+
+func (t *testTaskConcurrency) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	t.mux.Lock()
+	t.running++
+	if t.running > t.maxRunning {
+		t.maxRunning = t.running
+		if t.maxRunning == t.wait {
+			close(t.reached)
+		}
+	}
+	t.mux.Unlock()
+
+	defer func() {
+		t.mux.Lock()
+		t.running--
+		t.mux.Unlock()
+	}()
+
+	select {
+	case <-time.After(t.sleepDuration):
+		return testTaskSleepResults{success: true}, nil
+	case <-t.reached:
+		return testTaskSleepResults{success: true}, nil
+	case <-ctx.Done():
+		return testTaskSleepResults{}, ctx.Err()
+	}
+}
+
+// TestPool checks the runner executes the task over all the hosts using
+// as many workers as possible without exceeding the number of workers
+func TestPool(t *testing.T) {
+	testCases := []struct {
+		name       string
+		workers    int
+		expected   map[string]bool
+		concurrent int
+	}{
+		{
+			name:       "two workers",
+			workers:    2,
+			expected:   map[string]bool{"dev1": true, "dev2": true, "dev3": true, "dev4": true},
+			concurrent: 2,
+		},
+		{
+			name:       "more workers than hosts",
+			workers:    10,
+			expected:   map[string]bool{"dev1": true, "dev2": true, "dev3": true, "dev4": true},
+			concurrent: 4,
+		},
+	}
+
+	testHosts := map[string]*gornir.Host{
+		"dev1": {Hostname: "dev1"},
+		"dev2": {Hostname: "dev2"},
+		"dev3": {Hostname: "dev3"},
+		"dev4": {Hostname: "dev4"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		results := make(chan *gornir.JobResult, len(testHosts))
+		t.Run(tc.name, func(t *testing.T) {
+			// instances wait for each other so they all run at the same time unless the pool doesn't allow it
+			task := &testTaskConcurrency{sleepDuration: 5 * time.Second, wait: tc.concurrent, reached: make(chan struct{})}
+			rnr := runner.Pool(tc.workers)
+			if err := rnr.Run(
+				context.Background(),
+				NewNullLogger(),
+				make(gornir.Processors, 0),
+				task,
+				testHosts,
+				results,
+			); err != nil {
+				t.Fatal(err)
+			}
+			if err := rnr.Wait(); err != nil {
+				t.Fatal(err)
+			}
+			close(results)
+
+			got := make(map[string]bool)
+			for res := range results {
+				got[res.Host().Hostname] = res.Data().(testTaskSleepResults).success
+			}
+			if !cmp.Equal(got, tc.expected) {
+				t.Error(cmp.Diff(got, tc.expected))
+			}
+			if task.maxRunning != tc.concurrent {
+				t.Errorf("%d instances ran concurrently, expected %d with %d workers", task.maxRunning, tc.concurrent, tc.workers)
+			}
+		})
+	}
+}
+
+// TestPoolCancel checks that queued hosts are not executed once
+// the context is cancelled
+func TestPoolCancel(t *testing.T) {
+	testHosts := map[string]*gornir.Host{
+		"dev1": {Hostname: "dev1"},
+		"dev2": {Hostname: "dev2"},
+		"dev3": {Hostname: "dev3"},
+		"dev4": {Hostname: "dev4"},
+	}
+	results := make(chan *gornir.JobResult, len(testHosts))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	rnr := runner.Pool(1)
+	startTime := time.Now()
+	if err := rnr.Run(
+		ctx,
+		NewNullLogger(),
+		make(gornir.Processors, 0),
+		&testTaskConcurrency{sleepDuration: time.Second},
+		testHosts,
+		results,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := rnr.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	close(results)
+
+	if elapsed := time.Since(startTime); elapsed > 500*time.Millisecond {
+		t.Errorf("runner took %v, queued hosts might have been executed", elapsed)
+	}
+	n := 0
+	for res := range results {
+		n++
+		if res.Err() != context.DeadlineExceeded {
+			t.Errorf("%s: error should be 'context deadline exceeded'. Got: %v", res.Host().Hostname, res.Err())
+		}
+	}
+	if n != len(testHosts) {
+		t.Errorf("got %d results, want %d", n, len(testHosts))
+	}
+}
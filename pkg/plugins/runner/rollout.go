@@ -0,0 +1,189 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+
+	"github.com/pkg/errors"
+)
+
+// ErrRolloutAborted is the error set on the hosts that were not executed
+// because a previous batch crossed the failure thresholds
+var ErrRolloutAborted = errors.New("rollout aborted")
+
+// RolloutOptions controls how a RolloutRunner rolls out a task over the hosts
+type RolloutOptions struct {
+	BatchSize             int           // Number of hosts in each batch
+	BatchPercentage       float64       // Size of each batch as a percentage of the hosts, only used if BatchSize is 0
+	Pause                 time.Duration // Time to wait between batches
+	MaxStartsPerSecond    float64       // Maximum number of TaskInstances started per second, 0 means no limit
+	FailureThreshold      int           // Abort when a batch has at least this many failures, 0 disables it
+	FailureRatioThreshold float64       // Abort when the ratio of failed hosts in a batch is at least this value, 0 disables it
+}
+
+// RolloutRunner will sort the hosts alphabetically and execute the task over
+// them in batches, similar to a canary deployment. Hosts in the same batch are
+// executed in parallel and the next batch doesn't start until the previous one
+// is completed and the pause between batches has passed. If a batch crosses any
+// of the failure thresholds the remaining batches are aborted and the hosts in them
+// go through the processors with an error wrapping ErrRolloutAborted, which explains
+// why, as result.
+type RolloutRunner struct {
+	opts RolloutOptions
+	wg   *sync.WaitGroup
+}
+
+// Rollout returns an instantiated RolloutRunner
+func Rollout(opts RolloutOptions) *RolloutRunner {
+	return &RolloutRunner{
+		opts: opts,
+		wg:   &sync.WaitGroup{},
+	}
+}
+
+// batches splits the hosts in sorted batches according to the options
+func (r *RolloutRunner) batches(hosts map[string]*gornir.Host) [][]string {
+	hostnames := make([]string, 0, len(hosts))
+	for hostname := range hosts {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	size := r.opts.BatchSize
+	if size <= 0 && r.opts.BatchPercentage > 0 {
+		size = int(math.Ceil(float64(len(hostnames)) * r.opts.BatchPercentage / 100))
+	}
+	if size <= 0 || size > len(hostnames) {
+		size = len(hostnames)
+	}
+
+	batches := [][]string{}
+	for len(hostnames) > 0 {
+		n := size
+		if n > len(hostnames) {
+			n = len(hostnames)
+		}
+		batches = append(batches, hostnames[:n])
+		hostnames = hostnames[n:]
+	}
+	return batches
+}
+
+// Run implements the Run method of the gornir.Runner interface
+func (r *RolloutRunner) Run(ctx context.Context, logger gornir.Logger, processors gornir.Processors, task gornir.Task, hosts map[string]*gornir.Host, results chan *gornir.JobResult) error {
+	logger = logger.WithField("runner", "Rollout")
+	logger.Debug("starting runner")
+
+	if len(hosts) == 0 {
+		logger.Warn("no hosts to run against")
+		return nil
+	}
+
+	batches := r.batches(hosts)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		var interval time.Duration
+		if r.opts.MaxStartsPerSecond > 0 {
+			interval = time.Duration(float64(time.Second) / r.opts.MaxStartsPerSecond)
+		}
+		var lastStart time.Time
+
+		for i, batch := range batches {
+			batchLogger := logger.WithField("batch", i+1)
+			if i > 0 && r.opts.Pause > 0 {
+				batchLogger.Debug(fmt.Sprintf("pausing %s before next batch", r.opts.Pause))
+				sleep(ctx, r.opts.Pause)
+			}
+			batchLogger.Debug(fmt.Sprintf("starting batch %d of %d with %d hosts", i+1, len(batches), len(batch)))
+
+			wg := &sync.WaitGroup{}
+			wg.Add(len(batch))
+			batchResults := make(chan *gornir.JobResult, len(batch))
+			for _, hostname := range batch {
+				hostname := hostname
+				if interval > 0 && !lastStart.IsZero() {
+					sleep(ctx, interval-time.Since(lastStart))
+				}
+				lastStart = time.Now()
+
+				batchLogger.WithField("host", hostname).Debug("calling function")
+				go func() {
+					if err := gornir.TaskWrapper(ctx, batchLogger.WithField("host", hostname), processors, wg, task, hosts[hostname], batchResults); err != nil {
+						logger.Error(fmt.Sprintf("problem calling TaskWrapper: %s", err))
+					}
+				}()
+			}
+			wg.Wait()
+			close(batchResults)
+
+			failures := 0
+			for res := range batchResults {
+				if res.Err() != nil {
+					failures++
+				}
+				results <- res
+			}
+
+			if i == len(batches)-1 || !r.crossesThresholds(failures, len(batch)) {
+				continue
+			}
+
+			err := errors.Wrapf(ErrRolloutAborted, "batch %d of %d had %d failures out of %d hosts", i+1, len(batches), failures, len(batch))
+			batchLogger.Error(err.Error())
+
+			for _, remaining := range batches[i+1:] {
+				wg.Add(len(remaining))
+				for _, hostname := range remaining {
+					if err := gornir.SkipTask(ctx, logger.WithField("host", hostname), processors, wg, task, hosts[hostname], results, err); err != nil {
+						logger.Error(fmt.Sprintf("problem calling SkipTask: %s", err))
+					}
+				}
+			}
+			return
+		}
+	}()
+	return nil
+}
+
+func (r *RolloutRunner) crossesThresholds(failures, total int) bool {
+	if r.opts.FailureThreshold > 0 && failures >= r.opts.FailureThreshold {
+		return true
+	}
+	if r.opts.FailureRatioThreshold > 0 && float64(failures)/float64(total) >= r.opts.FailureRatioThreshold {
+		return true
+	}
+	return false
+}
+
+// sleep blocks for the given duration or until the context is done
+func sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// Wait implements the Wait method of the gornir.Runner interface
+func (r *RolloutRunner) Wait() error {
+	r.wg.Wait()
+	return nil
+}
+
+// Close implements the Close method of the gornir.Runner interface
+func (r *RolloutRunner) Close() error {
+	return nil
+}
@@ -0,0 +1,173 @@
+package runner_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/runner"
+)
+
+// testTaskFail fails on the given hosts
+type testTaskFail struct {
+	fail map[string]bool
+}
+
+func (t *testTaskFail) Metadata() *gornir.TaskMetadata {
+	return nil
+}
+
+func (t *testTaskFail) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	if t.fail[host.Hostname] {
+		return nil, errors.New("failed")
+	}
+	return testTaskSleepResults{success: true}, nil
+}
+
+// testCountProcessor counts the TaskInstances that went through the processors
+type testCountProcessor struct {
+	mux       sync.Mutex
+	started   int
+	completed int
+}
+
+func (p *testCountProcessor) TaskStarted(ctx context.Context, logger gornir.Logger, task gornir.Task) error {
+	return nil
+}
+
+func (p *testCountProcessor) TaskCompleted(ctx context.Context, logger gornir.Logger, task gornir.Task) error {
+	return nil
+}
+
+func (p *testCountProcessor) TaskInstanceStarted(ctx context.Context, logger gornir.Logger, host *gornir.Host, task gornir.Task) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.started++
+	return nil
+}
+
+func (p *testCountProcessor) TaskInstanceCompleted(ctx context.Context, logger gornir.Logger, jobResult *gornir.JobResult, host *gornir.Host, task gornir.Task) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.completed++
+	return nil
+}
+
+// TestRollout checks batches are executed in order and that the
+// rollout is aborted when a batch crosses the thresholds
+func TestRollout(t *testing.T) {
+	testHosts := map[string]*gornir.Host{
+		"dev1": {Hostname: "dev1"},
+		"dev2": {Hostname: "dev2"},
+		"dev3": {Hostname: "dev3"},
+		"dev4": {Hostname: "dev4"},
+		"dev5": {Hostname: "dev5"},
+	}
+
+	testCases := []struct {
+		name        string
+		opts        runner.RolloutOptions
+		fail        map[string]bool
+		expected    map[string]string
+		minDuration time.Duration
+	}{
+		{
+			name: "no failures",
+			opts: runner.RolloutOptions{BatchSize: 2, Pause: 50 * time.Millisecond, FailureThreshold: 1},
+			expected: map[string]string{
+				"dev1": "ok", "dev2": "ok", "dev3": "ok", "dev4": "ok", "dev5": "ok",
+			},
+			minDuration: 100 * time.Millisecond,
+		},
+		{
+			name: "abort on failure count",
+			opts: runner.RolloutOptions{BatchSize: 2, FailureThreshold: 1},
+			fail: map[string]bool{"dev3": true},
+			expected: map[string]string{
+				"dev1": "ok", "dev2": "ok", "dev3": "failed", "dev4": "ok", "dev5": "aborted",
+			},
+		},
+		{
+			name: "failures under the ratio",
+			opts: runner.RolloutOptions{BatchPercentage: 40, FailureRatioThreshold: 0.6},
+			fail: map[string]bool{"dev1": true},
+			expected: map[string]string{
+				"dev1": "failed", "dev2": "ok", "dev3": "ok", "dev4": "ok", "dev5": "ok",
+			},
+		},
+		{
+			name: "abort on failure ratio",
+			opts: runner.RolloutOptions{BatchPercentage: 40, FailureRatioThreshold: 0.5},
+			fail: map[string]bool{"dev1": true},
+			expected: map[string]string{
+				"dev1": "failed", "dev2": "ok", "dev3": "aborted", "dev4": "aborted", "dev5": "aborted",
+			},
+		},
+		{
+			name: "rate limited",
+			opts: runner.RolloutOptions{MaxStartsPerSecond: 20},
+			expected: map[string]string{
+				"dev1": "ok", "dev2": "ok", "dev3": "ok", "dev4": "ok", "dev5": "ok",
+			},
+			minDuration: 200 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			results := make(chan *gornir.JobResult, len(testHosts))
+			rnr := runner.Rollout(tc.opts)
+			processor := &testCountProcessor{}
+			startTime := time.Now()
+			if err := rnr.Run(
+				context.Background(),
+				NewNullLogger(),
+				gornir.Processors{processor},
+				&testTaskFail{fail: tc.fail},
+				testHosts,
+				results,
+			); err != nil {
+				t.Fatal(err)
+			}
+			if err := rnr.Wait(); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			close(results)
+
+			if processor.started != len(testHosts) || processor.completed != len(testHosts) {
+				t.Errorf("processors saw %d started and %d completed TaskInstances, expected %d", processor.started, processor.completed, len(testHosts))
+			}
+			if elapsed := time.Since(startTime); elapsed < tc.minDuration {
+				t.Errorf("rollout took %v, expected at least %v", elapsed, tc.minDuration)
+			}
+
+			agg := gornir.Aggregate(results)
+			got := make(map[string]string)
+			aborted := 0
+			for _, res := range agg {
+				if errors.Cause(res.Err()) == runner.ErrRolloutAborted {
+					aborted++
+					got[res.Host().Hostname] = "aborted"
+				} else if res.Err() != nil {
+					got[res.Host().Hostname] = res.Err().Error()
+				} else {
+					got[res.Host().Hostname] = "ok"
+				}
+			}
+			if !cmp.Equal(got, tc.expected) {
+				t.Error(cmp.Diff(got, tc.expected))
+			}
+			// aborted hosts are skipped, not failed
+			summary := agg.Summary()
+			if summary.Skipped != aborted || summary.Succeeded+summary.Failed+summary.Skipped != len(testHosts) {
+				t.Errorf("got summary %v with %d hosts aborted", summary, aborted)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+
+	"github.com/pkg/errors"
+)
+
+// RenderTemplate renders a text/template file against each host, like TemplatedCommand does,
+// with the variables in Vars available as .Vars. If Path is a directory, all the templates
+// in it are rendered in lexical order and concatenated, so configurations can be split in
+// sections, i.e. "00-base.tmpl" and "10-interfaces.tmpl". Templates matching Includes can
+// be used as partials by their file name, i.e. {{ template "banner.tmpl" . }}, and are not
+// rendered on their own even if they are inside Path. Templates are read once per run and
+// reused for all the hosts. Hosts rendering to the same Output in a run fail instead of
+// overwriting each other's result
+type RenderTemplate struct {
+	Path     string                 // Template file, or directory with templates, to render
+	Includes []string               // Glob patterns of the partials shared across templates, i.e. "templates/partials/*"
+	Vars     map[string]interface{} // Variables shared by all the hosts
+	Output   string                 // Template of the path to write the result to, i.e. "configs/{{ .Name }}.cfg", not written if empty
+	Meta     *gornir.TaskMetadata   // Task metadata
+}
+
+// renderRunKey stores the renderRun of a RenderTemplate, see gornir.RunValue
+type renderRunKey struct {
+	task *RenderTemplate
+}
+
+// renderRun is the state of a RenderTemplate shared by the hosts of a run
+type renderRun struct {
+	once    sync.Once
+	tmpl    *template.Template // parsed templates and partials
+	names   []string           // names of the templates to render, in order
+	err     error              // error parsing the templates
+	mux     sync.Mutex         // mux guards outputs
+	outputs map[string]string  // name of the host each Output was written for
+}
+
+// Metadata returns the task metadata
+func (t *RenderTemplate) Metadata() *gornir.TaskMetadata {
+	return t.Meta
+}
+
+// RenderTemplateResults is the result of calling RenderTemplate
+type RenderTemplateResults struct {
+	Text string // Rendered text
+	Path string // Path the text was written to, if any
+}
+
+// String implemente Stringer interface
+func (r RenderTemplateResults) String() string {
+	if r.Path != "" {
+		return fmt.Sprintf("  - rendered: %d bytes written to %s", len(r.Text), r.Path)
+	}
+	return fmt.Sprintf("  - rendered:\n%s", r.Text)
+}
+
+// templateFiles returns the files to render, sorted, skipping the partials
+func (t *RenderTemplate) templateFiles(partials map[string]bool) ([]string, error) {
+	info, err := os.Stat(t.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem reading templates")
+	}
+	if !info.IsDir() {
+		return []string{t.Path}, nil
+	}
+	files := []string{}
+	err = filepath.Walk(t.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !partials[filepath.Clean(path)] {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "problem reading templates")
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// parse parses the partials and the templates to render, returning the names of the latter in order
+func (t *RenderTemplate) parse() (*template.Template, []string, error) {
+	tmpl := newTemplate(filepath.Base(t.Path))
+	partials := make(map[string]bool)
+	for _, pattern := range t.Includes {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid include '%s'", pattern)
+		}
+		if len(matches) == 0 {
+			return nil, nil, errors.Errorf("no partials match '%s'", pattern)
+		}
+		if _, err := tmpl.ParseFiles(matches...); err != nil {
+			return nil, nil, errors.Wrap(err, "problem parsing partials")
+		}
+		for _, m := range matches {
+			partials[filepath.Clean(m)] = true
+		}
+	}
+	files, err := t.templateFiles(partials)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := make([]string, len(files))
+	for i, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "problem reading template")
+		}
+		// templates are named after their path relative to Path, or their file name
+		names[i] = filepath.Base(f)
+		if rel, err := filepath.Rel(t.Path, f); err == nil && rel != "." {
+			names[i] = rel
+		}
+		if _, err := tmpl.New(names[i]).Parse(string(b)); err != nil {
+			return nil, nil, errors.Wrap(err, "problem parsing template")
+		}
+	}
+	return tmpl, names, nil
+}
+
+// claimOutput records path as the output of the host, failing if another host already wrote to it
+func (r *renderRun) claimOutput(path string, host *gornir.Host) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if other, ok := r.outputs[path]; ok && other != host.Name {
+		return errors.Errorf("output %s was already written for host '%s'", path, other)
+	}
+	r.outputs[path] = host.Name
+	return nil
+}
+
+// Run renders the templates for the host and writes the result to Output, if set
+func (t *RenderTemplate) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	run := gornir.RunValue(ctx, renderRunKey{t}, func() interface{} {
+		return &renderRun{outputs: make(map[string]string)}
+	}).(*renderRun)
+	run.once.Do(func() { run.tmpl, run.names, run.err = t.parse() })
+	if run.err != nil {
+		return RenderTemplateResults{}, run.err
+	}
+	text := &strings.Builder{}
+	for _, name := range run.names {
+		out, err := renderTemplate(run.tmpl.Lookup(name), host, t.Vars)
+		if err != nil {
+			return RenderTemplateResults{}, err
+		}
+		text.WriteString(out)
+	}
+	res := RenderTemplateResults{Text: text.String()}
+	if t.Output == "" {
+		return res, nil
+	}
+
+	pathTmpl, err := newTemplate("output").Parse(t.Output)
+	if err != nil {
+		return res, errors.Wrap(err, "problem parsing output path")
+	}
+	path, err := renderTemplate(pathTmpl, host, t.Vars)
+	if err != nil {
+		return res, err
+	}
+	if err := run.claimOutput(filepath.Clean(path), host); err != nil {
+		return res, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return res, errors.Wrap(err, "failed to create output directory")
+	}
+	if err := ioutil.WriteFile(path, []byte(res.Text), 0644); err != nil {
+		return res, errors.Wrap(err, "failed to write output")
+	}
+	res.Path = path
+	return res, nil
+}
@@ -0,0 +1,190 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/logger"
+	"github.com/nornir-automation/gornir/pkg/plugins/runner"
+)
+
+func TestRenderTemplateTask(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gornir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"partials/banner.tmpl":        `banner motd "{{ .Vars.banner }}"`,
+		"config/00-base.tmpl":         "hostname {{ .Hostname }}\n{{ template \"banner.tmpl\" . }}\n",
+		"config/10-interfaces.tmpl":   "{{ range .Data.interfaces }}interface {{ . }}\n{{ end }}",
+		"config/20-ntp/ntp.tmpl":      "ntp server {{ .Data.ntp }}\n",
+		"broken/00-missing.tmpl":      "vlan {{ .Data.vlan }}\n",
+		"single/interfaces-only.tmpl": "{{ join \" \" .Data.interfaces }}",
+		"undefined/00-partial.tmpl":   "{{ template \"missing.tmpl\" . }}",
+		"partials/interface.tmpl":     `{{ define "interface" }}interface {{ . }}{{ end }}`,
+		"nested/00-base.tmpl":         `{{ template "shared.tmpl" . }} {{ .Hostname }}`,
+		"nested/partials/shared.tmpl": "shared",
+		"defined/00-uses-define.tmpl": `{{ template "interface" "Gi0/1" }}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	host := &gornir.Host{
+		Hostname: "router1",
+		Data: map[string]interface{}{
+			"interfaces": []interface{}{"Gi0/1", "Gi0/2"},
+			"ntp":        "10.0.0.1",
+		},
+	}
+	partials := []string{filepath.Join(dir, "partials", "*")}
+	testCases := []struct {
+		name     string
+		task     *RenderTemplate
+		expected string
+		path     string
+		err      string
+	}{
+		{
+			name: "directory",
+			task: &RenderTemplate{
+				Path:     filepath.Join(dir, "config"),
+				Includes: partials,
+				Vars:     map[string]interface{}{"banner": "authorized access only"},
+				Output:   filepath.Join(dir, "out", "{{ .Hostname }}.cfg"),
+			},
+			expected: "hostname router1\nbanner motd \"authorized access only\"\ninterface Gi0/1\ninterface Gi0/2\nntp server 10.0.0.1\n",
+			path:     filepath.Join(dir, "out", "router1.cfg"),
+		},
+		{
+			name:     "partials inside the path",
+			task:     &RenderTemplate{Path: filepath.Join(dir, "nested"), Includes: []string{filepath.Join(dir, "nested", "partials", "*")}},
+			expected: "shared router1",
+		},
+		{
+			name:     "file",
+			task:     &RenderTemplate{Path: filepath.Join(dir, "single", "interfaces-only.tmpl")},
+			expected: "Gi0/1 Gi0/2",
+		},
+		{
+			name:     "defined partials",
+			task:     &RenderTemplate{Path: filepath.Join(dir, "defined"), Includes: partials},
+			expected: "interface Gi0/1",
+		},
+		{
+			name: "missing key",
+			task: &RenderTemplate{Path: filepath.Join(dir, "broken")},
+			err:  `map has no entry for key "vlan"`,
+		},
+		{
+			name: "missing partial",
+			task: &RenderTemplate{Path: filepath.Join(dir, "undefined")},
+			err:  `00-partial.tmpl:1:12: executing "00-partial.tmpl" at <{{template "missing.tmpl" .}}>: template "missing.tmpl" not defined`,
+		},
+		{
+			name: "missing includes",
+			task: &RenderTemplate{Path: filepath.Join(dir, "config"), Includes: []string{filepath.Join(dir, "nothing", "*")}},
+			err:  "no partials match",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := tc.task.Run(context.Background(), logger.NewNull(), host)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("got error %v, want one containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := res.(RenderTemplateResults)
+			if r.Text != tc.expected {
+				t.Errorf("got %q, want %q", r.Text, tc.expected)
+			}
+			if r.Path != tc.path {
+				t.Errorf("got path %q, want %q", r.Path, tc.path)
+			}
+			if tc.path == "" {
+				return
+			}
+			written, err := ioutil.ReadFile(tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(written) != tc.expected {
+				t.Errorf("wrote %q, want %q", written, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateSameOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gornir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.tmpl")
+	task := &RenderTemplate{Path: path, Output: filepath.Join(dir, "out", "{{ .Data.site }}.cfg")}
+	// the inventory is loaded again for each run so hosts are new each time
+	run := func(names ...string) gornir.AggregatedResult {
+		inv := gornir.Inventory{Hosts: map[string]*gornir.Host{}}
+		for i, name := range names {
+			inv.Hosts[name] = &gornir.Host{Name: name, Hostname: fmt.Sprintf("router%d", i+1), Data: map[string]interface{}{"site": "bcn"}}
+		}
+		gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Sorted())
+		results, err := gr.RunSync(context.Background(), task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return gornir.Aggregate(results)
+	}
+
+	// errors parsing the templates are not kept across runs
+	if err := ioutil.WriteFile(path, []byte("hostname {{ .Hostname"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("dev1").Get("dev1").Err(); err == nil || !strings.Contains(err.Error(), "problem parsing template") {
+		t.Errorf("got error %v, want one parsing the template", err)
+	}
+	if err := ioutil.WriteFile(path, []byte("hostname {{ .Hostname }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res := run("dev1", "dev2")
+	if err := res.Get("dev1").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := res.Get("dev2").Err(); err == nil || !strings.Contains(err.Error(), "was already written for host 'dev1'") {
+		t.Errorf("got error %v, want one about host dev1", err)
+	}
+	written, err := ioutil.ReadFile(filepath.Join(dir, "out", "bcn.cfg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "hostname router1" {
+		t.Errorf("wrote %q, want %q", written, "hostname router1")
+	}
+
+	// the same output can be written again in the next run
+	if err := run("dev1").Get("dev1").Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,8 +3,6 @@ package task
 import (
 	"context"
 	"fmt"
-	"io"
-	"os"
 
 	"github.com/pkg/sftp"
 
@@ -14,11 +12,17 @@ import (
 	"github.com/pkg/errors"
 )
 
-// SFTPUpload will open a new SFTP session on an already opened ssh and upload a file
+// SFTPUpload will open a new SFTP session on an already opened ssh and upload a file or,
+// if Recursive is set, a directory. The progress is reported, in bytes per file, to the
+// processors implementing gornir.ProgressProcessor
 type SFTPUpload struct {
-	Src  string
-	Dst  string
-	Meta *gornir.TaskMetadata // Task metadata
+	Src           string               // Local file or directory to upload
+	Dst           string               // Remote path to upload Src to
+	Recursive     bool                 // Upload the content of Src, and its subdirectories, if it's a directory
+	SkipUnchanged bool                 // Skip files that already exist in Dst with the same size and modification time or checksum
+	Verify        bool                 // Compare the checksums of both files after uploading them, computed with sha256sum on the host if possible
+	Preserve      bool                 // Preserve permissions and modification times
+	Meta          *gornir.TaskMetadata // Task metadata
 }
 
 // Metadata returns the task metadata
@@ -28,42 +32,115 @@ func (t *SFTPUpload) Metadata() *gornir.TaskMetadata {
 
 // SFTPUploadResult is the result of calling SFTPUpload
 type SFTPUploadResult struct {
-	Bytes int64 // Bytes written
+	Bytes   int64 // Bytes written
+	Files   int   // Files uploaded
+	Skipped int   // Files skipped because they didn't change
 }
 
 // String implemente Stringer interface
 func (r SFTPUploadResult) String() string {
+	if r.Skipped > 0 {
+		return fmt.Sprintf("  - uploaded: %d bytes, %d files unchanged", r.Bytes, r.Skipped)
+	}
 	return fmt.Sprintf("  - uploaded: %d bytes", r.Bytes)
 }
 
-// Run implements will upload a file via sftp
+// Run uploads a file via sftp
 func (t *SFTPUpload) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
-	conn, err := host.GetConnection("ssh")
+	client, conn, err := sftpClient(ctx, host)
 	if err != nil {
-		return &SFTPUploadResult{}, errors.Wrap(err, "failed to retrieve connection")
+		return SFTPUploadResult{}, err
 	}
-	sshConn := conn.(*connection.SSH)
+	defer client.Close() // nolint
 
-	client, err := sftp.NewClient(sshConn.Client)
+	return t.upload(ctx, logger, host, remoteFS{client: client, conn: conn})
+}
+
+// upload transfers Src to Dst in the remote file system
+func (t *SFTPUpload) upload(ctx context.Context, logger gornir.Logger, host *gornir.Host, remote fileSystem) (SFTPUploadResult, error) {
+	opts := transferOptions{recursive: t.Recursive, skipUnchanged: t.SkipUnchanged, verify: t.Verify, preserve: t.Preserve}
+	tr := &transfer{ctx: ctx, logger: logger, host: host, src: localFS{}, dst: remote, opts: opts}
+	err := tr.run(t.Src, t.Dst)
+	res := SFTPUploadResult{Bytes: tr.res.bytes, Files: tr.res.files, Skipped: tr.res.skipped}
+	return res, errors.Wrap(err, "problem uploading")
+}
+
+// SFTPDownload will open a new SFTP session on an already opened ssh and download a file or,
+// if Recursive is set, a directory. Dst is a template, like the ones of TemplatedCommand,
+// so files from different hosts don't overwrite each other, i.e. "backups/{{ .Hostname }}".
+// The progress is reported, in bytes per file, to the processors implementing
+// gornir.ProgressProcessor
+type SFTPDownload struct {
+	Src           string               // Remote file or directory to download
+	Dst           string               // Template of the local path to download Src to
+	Recursive     bool                 // Download the content of Src, and its subdirectories, if it's a directory
+	SkipUnchanged bool                 // Skip files that already exist in Dst with the same size and modification time or checksum
+	Verify        bool                 // Compare the checksums of both files after downloading them, computed with sha256sum on the host if possible
+	Preserve      bool                 // Preserve permissions and modification times
+	Meta          *gornir.TaskMetadata // Task metadata
+}
+
+// Metadata returns the task metadata
+func (t *SFTPDownload) Metadata() *gornir.TaskMetadata {
+	return t.Meta
+}
+
+// SFTPDownloadResult is the result of calling SFTPDownload
+type SFTPDownloadResult struct {
+	Path    string // Local path Src was downloaded to
+	Bytes   int64  // Bytes read
+	Files   int    // Files downloaded
+	Skipped int    // Files skipped because they didn't change
+}
+
+// String implemente Stringer interface
+func (r SFTPDownloadResult) String() string {
+	if r.Skipped > 0 {
+		return fmt.Sprintf("  - downloaded: %d bytes to %s, %d files unchanged", r.Bytes, r.Path, r.Skipped)
+	}
+	return fmt.Sprintf("  - downloaded: %d bytes to %s", r.Bytes, r.Path)
+}
+
+// Run downloads a file via sftp
+func (t *SFTPDownload) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	dstTmpl, err := newTemplate("destination").Parse(t.Dst)
+	if err != nil {
+		return SFTPDownloadResult{}, errors.Wrap(err, "problem parsing destination")
+	}
+	dst, err := renderTemplate(dstTmpl, host, nil)
 	if err != nil {
-		return &SFTPUploadResult{}, errors.Wrap(err, "failed to create sftp client")
+		return SFTPDownloadResult{}, err
 	}
-	defer client.Close()
 
-	dstFile, err := client.Create(t.Dst)
+	client, conn, err := sftpClient(ctx, host)
 	if err != nil {
-		return &SFTPUploadResult{}, errors.Wrap(err, "failed to create destination file")
+		return SFTPDownloadResult{}, err
 	}
-	defer dstFile.Close()
+	defer client.Close() // nolint
 
-	srcFile, err := os.Open(t.Src)
+	return t.download(ctx, logger, host, remoteFS{client: client, conn: conn}, dst)
+}
+
+// download transfers Src from the remote file system to dst
+func (t *SFTPDownload) download(ctx context.Context, logger gornir.Logger, host *gornir.Host, remote fileSystem, dst string) (SFTPDownloadResult, error) {
+	opts := transferOptions{recursive: t.Recursive, skipUnchanged: t.SkipUnchanged, verify: t.Verify, preserve: t.Preserve}
+	tr := &transfer{ctx: ctx, logger: logger, host: host, src: remote, dst: localFS{}, opts: opts}
+	err := tr.run(t.Src, dst)
+	res := SFTPDownloadResult{Path: dst, Bytes: tr.res.bytes, Files: tr.res.files, Skipped: tr.res.skipped}
+	return res, errors.Wrap(err, "problem downloading")
+}
+
+// sftpClient opens a new SFTP session on the ssh connection of the host, which is returned as well
+func sftpClient(ctx context.Context, host *gornir.Host) (*sftp.Client, *connection.SSH, error) {
+	conn, err := host.GetConnectionContext(ctx, "ssh")
 	if err != nil {
-		return &SFTPUploadResult{}, errors.Wrap(err, "failed to open source file")
+		return nil, nil, errors.Wrap(err, "failed to retrieve connection")
 	}
+	sshConn := conn.(*connection.SSH)
 
-	bytes, err := io.Copy(dstFile, srcFile)
+	client, err := sftp.NewClient(sshConn.Client)
 	if err != nil {
-		return &SFTPUploadResult{}, errors.Wrap(err, "problem uploading file")
+		return nil, nil, errors.Wrap(err, "failed to create sftp client")
 	}
-	return SFTPUploadResult{bytes}, nil
+	return client, sshConn, nil
 }
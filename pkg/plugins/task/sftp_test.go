@@ -0,0 +1,257 @@
+package task
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/logger"
+	"github.com/nornir-automation/gornir/pkg/plugins/runner"
+
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+)
+
+// newSFTPClient returns a client connected to an in-process sftp server serving the local file system
+func newSFTPClient(t *testing.T) *sftp.Client {
+	serverConn, clientConn := net.Pipe()
+	server, err := sftp.NewServer(serverConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve() // nolint
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// funcTask runs the function
+type funcTask func(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error)
+
+func (f funcTask) Metadata() *gornir.TaskMetadata {
+	return nil
+}
+
+func (f funcTask) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	return f(ctx, logger, host)
+}
+
+// progressProcessor records the last progress reported for each item
+type progressProcessor struct {
+	mux      sync.Mutex
+	progress map[string][2]int64
+}
+
+func (p *progressProcessor) TaskStarted(context.Context, gornir.Logger, gornir.Task) error {
+	return nil
+}
+
+func (p *progressProcessor) TaskCompleted(context.Context, gornir.Logger, gornir.Task) error {
+	return nil
+}
+
+func (p *progressProcessor) TaskInstanceStarted(context.Context, gornir.Logger, *gornir.Host, gornir.Task) error {
+	return nil
+}
+
+func (p *progressProcessor) TaskInstanceCompleted(context.Context, gornir.Logger, *gornir.JobResult, *gornir.Host, gornir.Task) error {
+	return nil
+}
+
+func (p *progressProcessor) TaskInstanceProgress(ctx context.Context, logger gornir.Logger, host *gornir.Host, task gornir.Task, item string, done, total int64) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.progress[item] = [2]int64{done, total}
+	return nil
+}
+
+// runTask runs the task over a single host returning its result and the progress reported
+func runTask(t *testing.T, task gornir.Task) (*gornir.JobResult, map[string][2]int64) {
+	inv := gornir.Inventory{Hosts: map[string]*gornir.Host{"host1": {Hostname: "host1"}}}
+	processor := &progressProcessor{progress: make(map[string][2]int64)}
+	gr := gornir.New().WithInventory(inv).WithLogger(logger.NewNull()).WithRunner(runner.Sorted()).WithProcessor(processor)
+	results, err := gr.RunSync(context.Background(), task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gornir.Aggregate(results).Get("host1"), processor.progress
+}
+
+func writeFile(t *testing.T, path, content string, mode os.FileMode, mtime time.Time) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkMode(t *testing.T, path string, mode os.FileMode) {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != mode {
+		t.Errorf("%s: got mode %s, want %s", path, info.Mode().Perm(), mode)
+	}
+}
+
+func checkFile(t *testing.T, path, content string, mode os.FileMode, mtime time.Time) {
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Errorf("%s: got %q, want %q", path, got, content)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != mode {
+		t.Errorf("%s: got mode %s, want %s", path, info.Mode().Perm(), mode)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("%s: got mtime %s, want %s", path, info.ModTime(), mtime)
+	}
+}
+
+// sumFS computes checksums without opening the files, counting how many times they are opened
+type sumFS struct {
+	fileSystem
+	mux   sync.Mutex
+	opens int
+}
+
+func (fs *sumFS) Open(path string) (io.ReadCloser, error) {
+	fs.mux.Lock()
+	fs.opens++
+	fs.mux.Unlock()
+	return fs.fileSystem.Open(path)
+}
+
+func (fs *sumFS) Sum(ctx context.Context, path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
+
+func TestSFTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gornir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	client := newSFTPClient(t)
+	defer client.Close() // nolint
+
+	mtime := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "hello", 0640, mtime)
+	writeFile(t, filepath.Join(src, "sub", "b.txt"), "world!", 0600, mtime)
+	// directories that can't be written to are transferred too
+	if err := os.Chmod(filepath.Join(src, "sub"), 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, d := range []string{"src", "remote", filepath.Join("downloaded", "host1")} {
+			os.Chmod(filepath.Join(dir, d, "sub"), 0755) // nolint
+		}
+	}()
+
+	upload := &SFTPUpload{Src: src, Dst: filepath.Join(dir, "remote"), Recursive: true, Verify: true, Preserve: true, SkipUnchanged: true}
+	remote := &sumFS{fileSystem: remoteFS{client: client}}
+	uploadTask := funcTask(func(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+		return upload.upload(ctx, logger, host, remote)
+	})
+
+	// upload everything
+	res, progress := runTask(t, uploadTask)
+	if res.Err() != nil {
+		t.Fatal(res.Err())
+	}
+	if r := res.Data().(SFTPUploadResult); r.Files != 2 || r.Skipped != 0 || r.Bytes != 11 {
+		t.Errorf("got %+v, want 2 files and 11 bytes uploaded", r)
+	}
+	checkFile(t, filepath.Join(dir, "remote", "a.txt"), "hello", 0640, mtime)
+	checkFile(t, filepath.Join(dir, "remote", "sub", "b.txt"), "world!", 0600, mtime)
+	checkMode(t, filepath.Join(dir, "remote", "sub"), 0500)
+	if p := progress[filepath.Join(src, "sub", "b.txt")]; p != [2]int64{6, 6} {
+		t.Errorf("got progress %v, want 6 out of 6 bytes", p)
+	}
+
+	// files with the same size and modification time are not even compared
+	writeFile(t, filepath.Join(src, "a.txt"), "HELLO", 0640, mtime)
+	res, _ = runTask(t, uploadTask)
+	if res.Err() != nil {
+		t.Fatal(res.Err())
+	}
+	if r := res.Data().(SFTPUploadResult); r.Files != 0 || r.Skipped != 2 {
+		t.Errorf("got %+v, want 2 files skipped", r)
+	}
+
+	// otherwise, only files that changed are uploaded
+	mtime = mtime.Add(time.Hour)
+	writeFile(t, filepath.Join(src, "a.txt"), "HELLO", 0640, mtime)
+	if err := os.Chtimes(filepath.Join(src, "sub", "b.txt"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	res, _ = runTask(t, uploadTask)
+	if res.Err() != nil {
+		t.Fatal(res.Err())
+	}
+	if r := res.Data().(SFTPUploadResult); r.Files != 1 || r.Skipped != 1 || r.Bytes != 5 {
+		t.Errorf("got %+v, want 1 file uploaded and 1 skipped", r)
+	}
+	// checksums are computed by the file system
+	if remote.opens != 0 {
+		t.Errorf("remote files were opened %d times, want 0", remote.opens)
+	}
+
+	// and back
+	download := &SFTPDownload{Src: filepath.Join(dir, "remote"), Recursive: true, Preserve: true}
+	dst := filepath.Join(dir, "downloaded", "host1")
+	res, _ = runTask(t, funcTask(func(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+		return download.download(ctx, logger, host, remoteFS{client: client}, dst)
+	}))
+	if res.Err() != nil {
+		t.Fatal(res.Err())
+	}
+	checkFile(t, filepath.Join(dst, "a.txt"), "HELLO", 0640, mtime)
+	checkFile(t, filepath.Join(dst, "sub", "b.txt"), "world!", 0600, mtime.Add(-time.Hour))
+	checkMode(t, filepath.Join(dst, "sub"), 0500)
+
+	// directories are only transferred if told so
+	download.Recursive = false
+	if _, err := download.download(context.Background(), logger.NewNull(), &gornir.Host{}, remoteFS{client: client}, dst); err == nil || !strings.Contains(err.Error(), "is a directory") {
+		t.Errorf("got error %v, want one about the source being a directory", err)
+	}
+
+	// transfers stop when the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	upload.SkipUnchanged = false
+	if _, err := upload.upload(ctx, logger.NewNull(), &gornir.Host{}, remoteFS{client: client}); errors.Cause(err) != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,127 @@
+package task
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/connection"
+	"github.com/nornir-automation/gornir/pkg/plugins/platform"
+
+	"github.com/pkg/errors"
+)
+
+// openShell opens an interactive shell on the ssh connection of the host. If opts is not
+// set, the options of the driver for the platform of the host are used, see platform.ForHost
+func openShell(ctx context.Context, host *gornir.Host, opts *connection.ShellOptions) (*connection.Shell, error) {
+	var shellOpts connection.ShellOptions
+	if opts != nil {
+		shellOpts = *opts
+	} else {
+		driver, err := platform.ForHost(host)
+		if err != nil {
+			return nil, err
+		}
+		shellOpts = driver.ShellOptions()
+	}
+
+	conn, err := host.GetConnectionContext(ctx, "ssh")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve connection")
+	}
+	sshConn := conn.(*connection.SSH)
+
+	sh, err := sshConn.Shell(ctx, shellOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open shell")
+	}
+	return sh, nil
+}
+
+// SendCommand will open an interactive shell on an already opened ssh connection and
+// execute the given command, for devices that don't support RemoteCommand and whose
+// platform isn't registered as Interactive. The shell is configured by the driver for
+// the platform of the host unless Shell is set
+type SendCommand struct {
+	Command string                   // Command to execute
+	Shell   *connection.ShellOptions // Shell options, the ones for the platform of the host if not set
+	Meta    *gornir.TaskMetadata     // Task metadata
+}
+
+// Metadata returns the task metadata
+func (t *SendCommand) Metadata() *gornir.TaskMetadata {
+	return t.Meta
+}
+
+// SendCommandResults is the result of calling SendCommand
+type SendCommandResults struct {
+	Output string // Output of the command
+}
+
+// String implemente Stringer interface
+func (r SendCommandResults) String() string {
+	return fmt.Sprintf("  - output: %s", r.Output)
+}
+
+// Run runs the command in an interactive shell
+func (t *SendCommand) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	sh, err := openShell(ctx, host, t.Shell)
+	if err != nil {
+		return SendCommandResults{}, err
+	}
+	defer sh.Close() // nolint
+
+	out, err := sh.SendCommand(ctx, t.Command)
+	if err != nil {
+		return SendCommandResults{}, errors.Wrap(err, "failed to execute command")
+	}
+	return SendCommandResults{Output: out}, nil
+}
+
+// SendConfigSet will open an interactive shell on an already opened ssh connection,
+// enter configuration mode and execute the given commands. The shell is configured
+// by the driver for the platform of the host unless Shell is set
+type SendConfigSet struct {
+	Commands []string                 // Configuration commands to execute
+	Save     bool                     // Save the configuration afterwards, if the platform needs it
+	Shell    *connection.ShellOptions // Shell options, the ones for the platform of the host if not set
+	Meta     *gornir.TaskMetadata     // Task metadata
+}
+
+// Metadata returns the task metadata
+func (t *SendConfigSet) Metadata() *gornir.TaskMetadata {
+	return t.Meta
+}
+
+// SendConfigSetResults is the result of calling SendConfigSet
+type SendConfigSetResults struct {
+	Output string // Transcript of the session
+}
+
+// String implemente Stringer interface
+func (r SendConfigSetResults) String() string {
+	return fmt.Sprintf("  - output: %s", r.Output)
+}
+
+// Run runs the configuration commands in an interactive shell. On failure, the
+// result contains the transcript of the session up to that point
+func (t *SendConfigSet) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	sh, err := openShell(ctx, host, t.Shell)
+	if err != nil {
+		return SendConfigSetResults{}, err
+	}
+	defer sh.Close() // nolint
+
+	out, err := sh.SendConfigSet(ctx, t.Commands)
+	if err != nil {
+		return SendConfigSetResults{Output: out}, errors.Wrap(err, "failed to apply configuration")
+	}
+	if t.Save {
+		saved, err := sh.SaveConfig(ctx)
+		out += saved
+		if err != nil {
+			return SendConfigSetResults{Output: out}, err
+		}
+	}
+	return SendConfigSetResults{Output: out}, nil
+}
@@ -4,17 +4,26 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"time"
 
 	"github.com/nornir-automation/gornir/pkg/gornir"
 	"github.com/nornir-automation/gornir/pkg/plugins/connection"
+	"github.com/nornir-automation/gornir/pkg/plugins/platform"
 
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
 )
 
-// RemoteCommand will open a new Session on an already opened ssh connection and execute the given command
+// RemoteCommand will open a new Session on an already opened ssh connection and execute the given command.
+// Hosts whose platform is registered as Interactive, see platform.Driver, run the command in an interactive
+// shell like SendCommand does instead. Hosts without platform, or with one that isn't registered, always
+// run the command directly
 type RemoteCommand struct {
-	Command string               // Command to execute
-	Meta    *gornir.TaskMetadata // Task metadata
+	Command          string               // Command to execute
+	SuccessExitCodes []int                // Exit codes that count as success, only 0 if not set
+	Stream           bool                 // Deliver the output line by line as it's produced, see gornir.OutputProcessor
+	Meta             *gornir.TaskMetadata // Task metadata
 }
 
 // Metadata returns the task metadata
@@ -24,8 +33,13 @@ func (t *RemoteCommand) Metadata() *gornir.TaskMetadata {
 
 // RemoteCommandResults is the result of calling RemoteCommand
 type RemoteCommandResults struct {
-	Stdout []byte // Stdout written by the command
-	Stderr []byte // Stderr written by the command
+	Stdout   []byte        // Stdout written by the command
+	Stderr   []byte        // Stderr written by the command
+	ExitCode int           // Exit code of the command, -1 if it didn't report any
+	Signal   string        // Signal that killed the command, if any, i.e. "KILL"
+	Start    time.Time     // When the command was started
+	End      time.Time     // When the command finished
+	Duration time.Duration // How long the command took
 }
 
 // String implemente Stringer interface
@@ -33,26 +47,147 @@ func (r RemoteCommandResults) String() string {
 	return fmt.Sprintf("  - stdout: %s\n  - stderr: %s", r.Stdout, r.Stderr)
 }
 
-// Run runs a command on a remote device via ssh
+// success returns if the exit code counts as success
+func (t *RemoteCommand) success(exitCode int) bool {
+	if len(t.SuccessExitCodes) == 0 {
+		return exitCode == 0
+	}
+	for _, c := range t.SuccessExitCodes {
+		if c == exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs a command on a remote device via ssh. If the context is done before the command
+// completes, the command is killed and the error returned wraps the error of the context.
+// The result contains the output of the command even if it fails
 func (t *RemoteCommand) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
-	conn, err := host.GetConnection("ssh")
+	if driver, err := platform.ForHost(host); err == nil && driver.Interactive {
+		return t.runInShell(ctx, logger, host, driver)
+	}
+
+	conn, err := host.GetConnectionContext(ctx, "ssh")
 	if err != nil {
 		return RemoteCommandResults{}, errors.Wrap(err, "failed to retrieve connection")
 	}
 	sshConn := conn.(*connection.SSH)
 
-	session, err := sshConn.Client.NewSession()
+	session, err := sshConn.NewSession(ctx)
 	if err != nil {
 		return RemoteCommandResults{}, errors.Wrap(err, "failed to create session")
 	}
+	defer session.Close() // nolint
 
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 	session.Stdout = &stdout
 	session.Stderr = &stderr
+	if t.Stream {
+		stdoutStream := gornir.OutputWriter(ctx, logger, host, "stdout")
+		defer stdoutStream.Close() // nolint
+		stderrStream := gornir.OutputWriter(ctx, logger, host, "stderr")
+		defer stderrStream.Close() // nolint
+		session.Stdout = io.MultiWriter(&stdout, stdoutStream)
+		session.Stderr = io.MultiWriter(&stderr, stderrStream)
+	}
+
+	res := RemoteCommandResults{Start: time.Now()}
+	err = connection.RunContext(ctx, session, t.Command)
+	res.End = time.Now()
+	res.Duration = res.End.Sub(res.Start)
+	res.Stdout = stdout.Bytes()
+	res.Stderr = stderr.Bytes()
+
+	switch e := errors.Cause(err).(type) {
+	case nil:
+		res.ExitCode = 0
+	case *ssh.ExitError:
+		res.ExitCode = e.ExitStatus()
+		if e.Signal() != "" {
+			res.ExitCode = -1
+			res.Signal = e.Signal()
+			return res, errors.Errorf("command killed by signal %s", res.Signal)
+		}
+	default:
+		res.ExitCode = -1
+		return res, errors.Wrap(err, "failed to execute command")
+	}
+	if !t.success(res.ExitCode) {
+		return res, errors.Errorf("command exited with status %d", res.ExitCode)
+	}
+	return res, nil
+}
 
-	if err := session.Run(t.Command); err != nil {
-		return RemoteCommandResults{}, errors.Wrap(err, "failed to execute command")
+// runInShell runs the command in an interactive shell. CLIs don't report how commands
+// went so the output is returned as Stdout and ExitCode is 0 unless the command timed out
+func (t *RemoteCommand) runInShell(ctx context.Context, logger gornir.Logger, host *gornir.Host, driver platform.Driver) (RemoteCommandResults, error) {
+	opts := driver.ShellOptions()
+	sh, err := openShell(ctx, host, &opts)
+	if err != nil {
+		return RemoteCommandResults{}, err
 	}
-	return RemoteCommandResults{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}, nil
+	defer sh.Close() // nolint
+
+	var stdoutStream io.WriteCloser
+	if t.Stream {
+		stdoutStream = gornir.OutputWriter(ctx, logger, host, "stdout")
+		defer stdoutStream.Close() // nolint
+	}
+	res := RemoteCommandResults{Start: time.Now()}
+	out, err := sh.SendCommandStream(ctx, t.Command, stdoutStream)
+	res.End = time.Now()
+	res.Duration = res.End.Sub(res.Start)
+	if err != nil {
+		res.ExitCode = -1
+		return res, errors.Wrap(err, "failed to execute command")
+	}
+	res.Stdout = []byte(out)
+	return res, nil
+}
+
+// TemplatedCommand renders Template, a text/template, against each host and runs the
+// result like RemoteCommand would. Fields and methods of the host are available in the
+// template, i.e. {{ .Hostname }}, and .Data contains all the data the host has access to.
+// Accessing a key that doesn't exist is an error, optional keys can be read with get,
+// i.e. {{ get .Data "mtu" | default 1500 }}
+type TemplatedCommand struct {
+	Template         string               // Template of the command to execute
+	SuccessExitCodes []int                // Exit codes that count as success, only 0 if not set
+	Stream           bool                 // Deliver the output line by line as it's produced, see gornir.OutputProcessor
+	Meta             *gornir.TaskMetadata // Task metadata
+}
+
+// Metadata returns the task metadata
+func (t *TemplatedCommand) Metadata() *gornir.TaskMetadata {
+	return t.Meta
+}
+
+// TemplatedCommandResults is the result of calling TemplatedCommand
+type TemplatedCommandResults struct {
+	Command string // Command executed
+	RemoteCommandResults
+}
+
+// String implemente Stringer interface
+func (r TemplatedCommandResults) String() string {
+	return fmt.Sprintf("  - command: %s\n%s", r.Command, r.RemoteCommandResults)
+}
+
+// Run renders the command for the host and runs it via ssh
+func (t *TemplatedCommand) Run(ctx context.Context, logger gornir.Logger, host *gornir.Host) (gornir.TaskInstanceResult, error) {
+	tmpl, err := newTemplate("command").Parse(t.Template)
+	if err != nil {
+		return TemplatedCommandResults{}, errors.Wrap(err, "problem parsing template")
+	}
+	cmd, err := renderTemplate(tmpl, host, nil)
+	if err != nil {
+		return TemplatedCommandResults{}, err
+	}
+
+	remote := &RemoteCommand{Command: cmd, SuccessExitCodes: t.SuccessExitCodes, Stream: t.Stream, Meta: t.Meta}
+	res, err := remote.Run(ctx, logger, host)
+	r, _ := res.(RemoteCommandResults)
+	return TemplatedCommandResults{Command: cmd, RemoteCommandResults: r}, err
 }
@@ -0,0 +1,181 @@
+package task
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// templateData is what templates are rendered against. Fields and methods of the host
+// are available directly, i.e. {{ .Hostname }}, while Data contains all the data the
+// host has access to, including the one inherited from its groups and the defaults
+type templateData struct {
+	*gornir.Host
+	Data map[string]interface{} // Data of the host, see gornir.Host.AllData
+	Vars map[string]interface{} // Variables shared by all the hosts
+}
+
+// templateFuncs are the functions available in the templates on top of
+// the ones built in text/template, similar to the ones in sprig
+var templateFuncs = template.FuncMap{
+	"get":        get,
+	"hasKey":     hasKey,
+	"default":    defaultValue,
+	"required":   required,
+	"empty":      empty,
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":       join,
+	"quote":      func(v interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(v)) },
+	"indent":     indent,
+	"nindent":    func(n int, s string) string { return "\n" + indent(n, s) },
+	"toYaml":     toYaml,
+	"add":        func(a, b int) int { return a + b },
+	"sub":        func(a, b int) int { return a - b },
+	"list":       func(v ...interface{}) []interface{} { return v },
+	"dict":       dict,
+}
+
+// newTemplate returns an empty template with the helper functions that fails when
+// trying to access a key that doesn't exist, i.e. {{ .Data.mtu }}. Optional keys
+// can be read with get, i.e. {{ get .Data "mtu" | default 1500 }}
+func newTemplate(name string) *template.Template {
+	return template.New(name).Option("missingkey=error").Funcs(templateFuncs)
+}
+
+// renderTemplate executes the template against the host and vars
+func renderTemplate(tmpl *template.Template, host *gornir.Host, vars map[string]interface{}) (string, error) {
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+	out := &strings.Builder{}
+	data := templateData{Host: host, Data: host.AllData(), Vars: vars}
+	if err := tmpl.Execute(out, data); err != nil {
+		return "", errors.Wrapf(err, "problem rendering template for %s", host.Hostname)
+	}
+	return out.String(), nil
+}
+
+// mapIndex returns the value stored under key in the map m, which can have keys of any
+// type, i.e. the map[interface{}]interface{} nested data is unmarshalled to. A nil m
+// has no keys so lookups can be chained, i.e. {{ get (get .Data "ntp") "server" }}
+func mapIndex(m interface{}, key string) (reflect.Value, bool, error) {
+	if m == nil {
+		return reflect.Value{}, false, nil
+	}
+	rv := reflect.ValueOf(m)
+	if rv.Kind() != reflect.Map {
+		return reflect.Value{}, false, errors.Errorf("can't look up keys in %T", m)
+	}
+	k := reflect.ValueOf(key)
+	switch {
+	case k.Type().AssignableTo(rv.Type().Key()):
+	case k.Type().ConvertibleTo(rv.Type().Key()):
+		k = k.Convert(rv.Type().Key())
+	default:
+		return reflect.Value{}, false, nil
+	}
+	v := rv.MapIndex(k)
+	return v, v.IsValid(), nil
+}
+
+// get returns the value stored under key in the map or nil if there is none, so optional
+// keys can be used along default and required, i.e. {{ get .Data "mtu" | default 1500 }}
+func get(m interface{}, key string) (interface{}, error) {
+	v, ok, err := mapIndex(m, key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// hasKey returns if the map has the key, i.e. {{ if hasKey .Data "vlan" }}
+func hasKey(m interface{}, key string) (bool, error) {
+	_, ok, err := mapIndex(m, key)
+	return ok, err
+}
+
+// empty returns if v is the zero value of its type or an empty collection
+func empty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	default:
+		return reflect.DeepEqual(v, reflect.Zero(rv.Type()).Interface())
+	}
+}
+
+// defaultValue returns def if v is empty, i.e. {{ get .Data "mtu" | default 1500 }}
+func defaultValue(def interface{}, v ...interface{}) interface{} {
+	if len(v) == 0 || empty(v[0]) {
+		return def
+	}
+	return v[0]
+}
+
+// required fails with msg if v is empty, i.e. {{ required "vrf is needed" (get .Data "vrf") }}
+func required(msg string, v interface{}) (interface{}, error) {
+	if empty(v) {
+		return nil, errors.New(msg)
+	}
+	return v, nil
+}
+
+// join joins the elements of the list, of any type, with sep
+func join(sep string, v interface{}) (string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", errors.Errorf("can't join %T", v)
+	}
+	elems := make([]string, rv.Len())
+	for i := range elems {
+		elems[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return strings.Join(elems, sep), nil
+}
+
+// indent adds n spaces at the beginning of each line
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+// toYaml marshals v as YAML without the trailing new line
+func toYaml(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	return strings.TrimSuffix(string(b), "\n"), err
+}
+
+// dict builds a map from a list of key and value pairs, i.e. {{ template "x" dict "name" .Hostname }}
+func dict(v ...interface{}) (map[string]interface{}, error) {
+	if len(v)%2 != 0 {
+		return nil, errors.New("dict needs an even number of arguments")
+	}
+	res := make(map[string]interface{}, len(v)/2)
+	for i := 0; i < len(v); i += 2 {
+		key, ok := v[i].(string)
+		if !ok {
+			return nil, errors.Errorf("dict keys must be strings, got %T", v[i])
+		}
+		res[key] = v[i+1]
+	}
+	return res, nil
+}
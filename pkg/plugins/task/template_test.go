@@ -0,0 +1,97 @@
+package task
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	host := &gornir.Host{
+		Hostname: "router1",
+		Platform: "ios",
+		Data: map[string]interface{}{
+			"vrf":        "mgmt",
+			"interfaces": []interface{}{"Gi0/1", "Gi0/2"},
+			"ntp":        map[interface{}]interface{}{"server": "10.0.0.1"},
+			"mtu":        0,
+		},
+	}
+	testCases := []struct {
+		name     string
+		template string
+		vars     map[string]interface{}
+		expected string
+		err      string
+	}{
+		{
+			name:     "host fields and data",
+			template: "show ip route vrf {{ .Data.vrf }} # {{ .Hostname }} ({{ .GetPlatform }})",
+			expected: "show ip route vrf mgmt # router1 (ios)",
+		},
+		{
+			name:     "loops and helpers",
+			template: `{{ range .Data.interfaces }}show interface {{ . | lower }}; {{ end }}{{ join "," .Data.interfaces }}`,
+			expected: "show interface gi0/1; show interface gi0/2; Gi0/1,Gi0/2",
+		},
+		{
+			name:     "defaults and nested data",
+			template: `mtu {{ .Data.mtu | default 1500 }}{{ "\n" }}ntp server {{ .Data.ntp.server }}{{ "x\ny" | nindent 2 }}`,
+			expected: "mtu 1500\nntp server 10.0.0.1\n  x\n  y",
+		},
+		{
+			name:     "optional keys",
+			template: `vlan {{ get .Data "vlan" | default 10 }} {{ index .Data "vlan" | default 20 }} {{ get .Data.ntp "port" | default 123 }} {{ get (get .Data "snmp") "community" | default "public" }} {{ hasKey .Data "vrf" }} {{ hasKey .Data "vlan" }}`,
+			expected: "vlan 10 20 123 public true false",
+		},
+		{
+			name:     "required missing key",
+			template: `{{ required "vlan must be set" (get .Data "vlan") }}`,
+			err:      "vlan must be set",
+		},
+		{
+			name:     "get on a non map",
+			template: `{{ get .Data.vrf "name" }}`,
+			err:      "can't look up keys in string",
+		},
+		{
+			name:     "vars",
+			template: `{{ .Vars.domain | upper | quote }}`,
+			vars:     map[string]interface{}{"domain": "example.com"},
+			expected: `"EXAMPLE.COM"`,
+		},
+		{
+			name:     "missing key",
+			template: "show vlan {{ .Data.vlan }}",
+			err:      `map has no entry for key "vlan"`,
+		},
+		{
+			name:     "required",
+			template: `{{ required "mtu must be set" .Data.mtu }}`,
+			err:      "mtu must be set",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := newTemplate("test").Parse(tc.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := renderTemplate(tmpl, host, tc.vars)
+			if tc.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), "problem rendering template for router1") || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("got error %v, want one containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.expected {
+				t.Errorf("got %q, want %q", got, tc.expected)
+			}
+		})
+	}
+}
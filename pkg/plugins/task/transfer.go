@@ -0,0 +1,381 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nornir-automation/gornir/pkg/gornir"
+	"github.com/nornir-automation/gornir/pkg/plugins/connection"
+
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+)
+
+// fileSystem abstracts the local and remote file systems so files can be transferred in both directions
+type fileSystem interface {
+	Open(path string) (io.ReadCloser, error)
+	Create(path string, mode os.FileMode) (io.WriteCloser, error) // mode is only applied if it's not 0
+	Stat(path string) (os.FileInfo, error)
+	MkdirAll(path string) error
+	Chmod(path string, mode os.FileMode) error
+	Chtimes(path string, atime, mtime time.Time) error
+	Walk(root string, fn func(path string, info os.FileInfo) error) error
+	Join(elem ...string) string
+	Rel(base, target string) (string, error)
+}
+
+// checksummer is implemented by the file systems that can compute the sha256 checksum
+// of a file without reading it
+type checksummer interface {
+	Sum(ctx context.Context, path string) ([]byte, error)
+}
+
+// localFS is the local file system
+type localFS struct{}
+
+func (localFS) Open(path string) (io.ReadCloser, error)   { return os.Open(path) } // #nosec
+func (localFS) Stat(path string) (os.FileInfo, error)     { return os.Stat(path) }
+func (localFS) MkdirAll(path string) error                { return os.MkdirAll(path, 0755) }
+func (localFS) Chmod(path string, mode os.FileMode) error { return os.Chmod(path, mode) }
+func (localFS) Join(elem ...string) string                { return filepath.Join(elem...) }
+func (localFS) Rel(base, target string) (string, error)   { return filepath.Rel(base, target) }
+
+// Create truncates the file before changing its permissions, so what it contained is
+// never exposed with the new ones, and before anything is written to it
+func (localFS) Create(path string, mode os.FileMode) (io.WriteCloser, error) {
+	perm := mode
+	if perm == 0 {
+		perm = 0666
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm) // #nosec
+	if err != nil || mode == 0 {
+		return f, err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close() // nolint
+		return nil, err
+	}
+	return f, nil
+}
+
+func (localFS) Chtimes(path string, atime, mtime time.Time) error {
+	return os.Chtimes(path, atime, mtime)
+}
+
+func (localFS) Walk(root string, fn func(path string, info os.FileInfo) error) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return fn(path, info)
+	})
+}
+
+// remoteFS is the file system of a host accessed via sftp
+type remoteFS struct {
+	client *sftp.Client
+	conn   *connection.SSH // connection to compute checksums with sha256sum, if set
+}
+
+func (r remoteFS) Open(path string) (io.ReadCloser, error)   { return r.client.Open(path) }
+func (r remoteFS) Stat(path string) (os.FileInfo, error)     { return r.client.Stat(path) }
+func (r remoteFS) MkdirAll(path string) error                { return r.client.MkdirAll(path) }
+func (r remoteFS) Chmod(path string, mode os.FileMode) error { return r.client.Chmod(path, mode) }
+func (r remoteFS) Join(elem ...string) string                { return r.client.Join(elem...) }
+
+// Create truncates the file before changing its permissions, as sftp can't set them when
+// opening the file, so its content is never exposed with the old ones
+func (r remoteFS) Create(path string, mode os.FileMode) (io.WriteCloser, error) {
+	f, err := r.client.Create(path)
+	if err != nil || mode == 0 {
+		return f, err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close() // nolint
+		return nil, err
+	}
+	return f, nil
+}
+
+// Sum runs sha256sum on the host, which fails if it's not available
+func (r remoteFS) Sum(ctx context.Context, p string) ([]byte, error) {
+	if r.conn == nil {
+		return nil, errors.New("no connection to run sha256sum")
+	}
+	session, err := r.conn.NewSession(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create session")
+	}
+	defer session.Close() // nolint
+	var stdout bytes.Buffer
+	session.Stdout = &stdout
+	if err := connection.RunContext(ctx, session, "sha256sum -- '"+strings.Replace(p, "'", `'\''`, -1)+"'"); err != nil {
+		return nil, errors.Wrap(err, "failed to run sha256sum")
+	}
+	fields := strings.Fields(stdout.String())
+	if len(fields) == 0 {
+		return nil, errors.New("sha256sum returned nothing")
+	}
+	sum, err := hex.DecodeString(fields[0])
+	if err != nil || len(sum) != sha256.Size {
+		return nil, errors.Errorf("unexpected output of sha256sum: %s", stdout.String())
+	}
+	return sum, nil
+}
+
+func (r remoteFS) Chtimes(path string, atime, mtime time.Time) error {
+	return r.client.Chtimes(path, atime, mtime)
+}
+
+func (r remoteFS) Walk(root string, fn func(path string, info os.FileInfo) error) error {
+	walker := r.client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		if err := fn(walker.Path(), walker.Stat()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r remoteFS) Rel(base, target string) (string, error) {
+	base, target = path.Clean(base), path.Clean(target)
+	if target == base {
+		return ".", nil
+	}
+	if !strings.HasPrefix(target, strings.TrimSuffix(base, "/")+"/") {
+		return "", errors.Errorf("%s is not in %s", target, base)
+	}
+	return strings.TrimPrefix(target, strings.TrimSuffix(base, "/")+"/"), nil
+}
+
+// transferOptions configures how files are transferred
+type transferOptions struct {
+	recursive     bool // transfer directories
+	skipUnchanged bool // skip files with the same size and modification time or checksum
+	verify        bool // compare the checksums after transferring
+	preserve      bool // preserve permissions and modification times
+}
+
+// transferResult summarizes a transfer
+type transferResult struct {
+	bytes   int64
+	files   int
+	skipped int
+}
+
+// transfer copies files between two file systems reporting
+// the progress to the processors of the TaskInstance
+type transfer struct {
+	ctx    context.Context
+	logger gornir.Logger
+	host   *gornir.Host
+	src    fileSystem
+	dst    fileSystem
+	opts   transferOptions
+	res    transferResult
+	noSum  bool // the file systems can't compute checksums by themselves
+}
+
+// dirMode is the mode of a directory to apply once its content is transferred
+type dirMode struct {
+	path string
+	mode os.FileMode
+}
+
+// run transfers src to dst. If src is a directory, its content is transferred
+// recursively into dst, which is created if needed. The permissions of the
+// directories are preserved once all the files are transferred, so directories
+// that can't be written to don't stop the transfer
+func (t *transfer) run(src, dst string) error {
+	info, err := t.src.Stat(src)
+	if err != nil {
+		return errors.Wrap(err, "failed to stat source")
+	}
+	if !info.IsDir() {
+		return t.copyFile(src, dst, info)
+	}
+	if !t.opts.recursive {
+		return errors.Errorf("%s is a directory, transferring it needs to be recursive", src)
+	}
+	dirs := []dirMode{}
+	err = t.src.Walk(src, func(p string, info os.FileInfo) error {
+		rel, err := t.src.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := t.dst.Join(dst, filepath.ToSlash(rel))
+		if !info.IsDir() {
+			return t.copyFile(p, target, info)
+		}
+		if err := t.dst.MkdirAll(target); err != nil {
+			return errors.Wrapf(err, "failed to create directory %s", target)
+		}
+		dirs = append(dirs, dirMode{path: target, mode: info.Mode().Perm()})
+		return nil
+	})
+	if err != nil || !t.opts.preserve {
+		return err
+	}
+	// subdirectories first in case a parent doesn't allow changing them
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := t.dst.Chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return errors.Wrapf(err, "failed to preserve permissions of %s", dirs[i].path)
+		}
+	}
+	return nil
+}
+
+// copyFile copies the file src, described by info, to dst
+func (t *transfer) copyFile(src, dst string, info os.FileInfo) error {
+	if err := t.ctx.Err(); err != nil {
+		return errors.Wrap(err, "context done")
+	}
+	if t.opts.skipUnchanged {
+		unchanged, err := t.unchanged(src, dst, info)
+		if err != nil {
+			return err
+		}
+		if unchanged {
+			t.res.skipped++
+			return nil
+		}
+	}
+
+	in, err := t.src.Open(src)
+	if err != nil {
+		return errors.Wrap(err, "failed to open source file")
+	}
+	defer in.Close() // nolint
+	var mode os.FileMode
+	if t.opts.preserve {
+		mode = info.Mode().Perm()
+	}
+	out, err := t.dst.Create(dst, mode)
+	if err != nil {
+		return errors.Wrap(err, "failed to create destination file")
+	}
+	progress := &progressWriter{t: t, item: src, total: info.Size()}
+	n, err := io.Copy(io.MultiWriter(out, progress), &contextReader{ctx: t.ctx, r: in})
+	// writes might only be flushed when closing
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	t.res.bytes += n
+	if err != nil {
+		return errors.Wrapf(err, "problem transferring %s", src)
+	}
+	t.res.files++
+
+	if t.opts.verify {
+		if err := t.verify(src, dst); err != nil {
+			return err
+		}
+	}
+	if t.opts.preserve {
+		if err := t.dst.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+			return errors.Wrapf(err, "failed to preserve modification time of %s", dst)
+		}
+	}
+	return nil
+}
+
+// unchanged returns if dst exists and has the same size as src and, either the same
+// modification time, or the same checksum
+func (t *transfer) unchanged(src, dst string, info os.FileInfo) (bool, error) {
+	dstInfo, err := t.dst.Stat(dst)
+	if err != nil || dstInfo.IsDir() || dstInfo.Size() != info.Size() {
+		return false, nil
+	}
+	// sftp only keeps seconds
+	if dstInfo.ModTime().Unix() == info.ModTime().Unix() {
+		return true, nil
+	}
+	srcSum, err := t.checksum(t.src, src)
+	if err != nil {
+		return false, err
+	}
+	dstSum, err := t.checksum(t.dst, dst)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(srcSum, dstSum), nil
+}
+
+// verify compares the checksums of src and dst
+func (t *transfer) verify(src, dst string) error {
+	srcSum, err := t.checksum(t.src, src)
+	if err != nil {
+		return err
+	}
+	dstSum, err := t.checksum(t.dst, dst)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(srcSum, dstSum) {
+		return errors.Errorf("checksum of %s doesn't match the one of %s", dst, src)
+	}
+	return nil
+}
+
+// checksum returns the sha256 checksum of the file, computed by the file system if it
+// can, so the file doesn't need to be transferred, or reading the file otherwise
+func (t *transfer) checksum(fs fileSystem, p string) ([]byte, error) {
+	if cs, ok := fs.(checksummer); ok && !t.noSum {
+		sum, err := cs.Sum(t.ctx, p)
+		if err == nil {
+			return sum, nil
+		}
+		t.logger.Debug(errors.Wrap(err, "reading files to compute their checksums").Error())
+		t.noSum = true
+	}
+	f, err := fs.Open(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s to compute its checksum", p)
+	}
+	defer f.Close() // nolint
+	h := sha256.New()
+	if _, err := io.Copy(h, &contextReader{ctx: t.ctx, r: f}); err != nil {
+		return nil, errors.Wrapf(err, "failed to compute the checksum of %s", p)
+	}
+	return h.Sum(nil), nil
+}
+
+// contextReader stops reading once the context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, errors.Wrap(err, "context done")
+	}
+	return r.r.Read(p)
+}
+
+// progressWriter counts the bytes written to it and reports them with gornir.EmitProgress
+type progressWriter struct {
+	t     *transfer
+	item  string
+	done  int64
+	total int64
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.done += int64(len(p))
+	if err := gornir.EmitProgress(w.t.ctx, w.t.logger, w.t.host, w.item, w.done, w.total); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}